@@ -0,0 +1,97 @@
+package milk
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+// PathParams provides access to the path parameters matched for a request.
+type PathParams interface {
+	// ByName returns the value of the path parameter with the given name, or an empty string if there is none.
+	ByName(name string) string
+}
+
+// PathParamsLister is optionally implemented by PathParams of other backends to list all path parameters,
+// as used by Params.All. The path parameters of the default backend are always listed.
+type PathParamsLister interface {
+	// List returns the names and values of all path parameters, in order.
+	List() (names, values []string)
+}
+
+// Handle is the function called by a Backend for requests matching a registered route.
+type Handle func(w http.ResponseWriter, r *http.Request, p PathParams)
+
+// Backend is the routing implementation a Router registers its routes on and dispatches requests with.
+// The default backend is based on github.com/julienschmidt/httprouter; see WithBackend for using another one.
+type Backend interface {
+	http.Handler
+
+	// Handle registers handle for requests with the given method and path pattern.
+	Handle(method, path string, handle Handle)
+
+	// Lookup returns the handle and path parameters registered for the method and path,
+	// or a nil Handle if no route matches.
+	Lookup(method, path string) (Handle, PathParams)
+
+	// SetNotFound sets the handler for requests that don't match any route.
+	SetNotFound(h http.Handler)
+
+	// SetMethodNotAllowed sets the handler for requests whose path only matches routes registered for other methods.
+	SetMethodNotAllowed(h http.Handler)
+}
+
+// OptionsBackend is optionally implemented by Backends answering OPTIONS requests to paths without an OPTIONS
+// route themselves. The router sets h, run by the backend after setting the Allow header for such requests,
+// so the router's middleware, like CORSPreflight, sees them.
+type OptionsBackend interface {
+	SetOptions(h http.Handler)
+}
+
+// httprouterBackend is the default Backend, based on httprouter.
+type httprouterBackend struct {
+	r *httprouter.Router
+}
+
+// listPathParams returns the names and values of all path parameters in p, if p supports listing them.
+func listPathParams(p PathParams) (names, values []string) {
+	switch p := p.(type) {
+	case httprouter.Params:
+		for _, param := range p {
+			names = append(names, param.Key)
+			values = append(values, param.Value)
+		}
+	case PathParamsLister:
+		names, values = p.List()
+	}
+	return names, values
+}
+
+func (this *httprouterBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.r.ServeHTTP(w, r)
+}
+
+func (this *httprouterBackend) Handle(method, path string, handle Handle) {
+	this.r.Handle(method, path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		handle(w, r, p)
+	})
+}
+
+func (this *httprouterBackend) Lookup(method, path string) (Handle, PathParams) {
+	handle, p, _ := this.r.Lookup(method, path)
+	if handle == nil {
+		return nil, nil
+	}
+	return func(w http.ResponseWriter, r *http.Request, _ PathParams) { handle(w, r, p) }, p
+}
+
+func (this *httprouterBackend) SetNotFound(h http.Handler) {
+	this.r.NotFound = h
+}
+
+func (this *httprouterBackend) SetMethodNotAllowed(h http.Handler) {
+	this.r.MethodNotAllowed = h
+}
+
+func (this *httprouterBackend) SetOptions(h http.Handler) {
+	this.r.GlobalOPTIONS = h
+}
@@ -0,0 +1,154 @@
+package milk
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeBackend is a minimal Backend based on the standard library, matching ":name" and "*name" segments.
+// Unlike httprouter, it allows static segments next to parameters, e.g. /users/export and /users/:id.
+type fakeBackend struct {
+	routes           []fakeRoute
+	notFound         http.Handler
+	methodNotAllowed http.Handler
+}
+
+type fakeRoute struct {
+	method   string
+	segments []string
+	handle   Handle
+}
+
+// fakeParams are the path parameters of the fakeBackend.
+type fakeParams struct {
+	names, values []string
+}
+
+func (this *fakeParams) ByName(name string) string {
+	for i, n := range this.names {
+		if n == name {
+			return this.values[i]
+		}
+	}
+	return ""
+}
+
+func (this *fakeParams) List() (names, values []string) {
+	return this.names, this.values
+}
+
+func (this *fakeBackend) Handle(method, path string, handle Handle) {
+	this.routes = append(this.routes, fakeRoute{method: method, segments: strings.Split(path, "/"), handle: handle})
+	// static segments take precedence over parameters
+	sort.SliceStable(this.routes, func(i, j int) bool {
+		return !strings.ContainsAny(strings.Join(this.routes[i].segments, "/"), ":*") &&
+			strings.ContainsAny(strings.Join(this.routes[j].segments, "/"), ":*")
+	})
+}
+
+func (this *fakeBackend) match(route fakeRoute, path string) (*fakeParams, bool) {
+	segments := strings.Split(path, "/")
+	p := &fakeParams{}
+	for i, s := range route.segments {
+		switch {
+		case strings.HasPrefix(s, "*"):
+			p.names, p.values = append(p.names, s[1:]), append(p.values, "/"+strings.Join(segments[i:], "/"))
+			return p, true
+		case i >= len(segments):
+			return nil, false
+		case strings.HasPrefix(s, ":") && segments[i] != "":
+			p.names, p.values = append(p.names, s[1:]), append(p.values, segments[i])
+		case s != segments[i]:
+			return nil, false
+		}
+	}
+	return p, len(segments) == len(route.segments)
+}
+
+func (this *fakeBackend) Lookup(method, path string) (Handle, PathParams) {
+	for _, route := range this.routes {
+		if p, ok := this.match(route, path); ok && route.method == method {
+			return route.handle, p
+		}
+	}
+	return nil, nil
+}
+
+func (this *fakeBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if handle, p := this.Lookup(r.Method, r.URL.Path); handle != nil {
+		handle(w, r, p)
+		return
+	}
+	for _, route := range this.routes {
+		if _, ok := this.match(route, r.URL.Path); ok {
+			this.methodNotAllowed.ServeHTTP(w, r)
+			return
+		}
+	}
+	this.notFound.ServeHTTP(w, r)
+}
+
+func (this *fakeBackend) SetNotFound(h http.Handler) {
+	this.notFound = h
+}
+
+func (this *fakeBackend) SetMethodNotAllowed(h http.Handler) {
+	this.methodNotAllowed = h
+}
+
+func TestBackends(t *testing.T) {
+	backends := []struct {
+		name string
+		opts []RouterOption
+	}{
+		{name: "httprouter"},
+		{name: "fake", opts: []RouterOption{WithBackend(func() Backend { return &fakeBackend{} })}},
+	}
+	tests := []struct {
+		name     string
+		fakeOnly bool
+		method   string
+		url      string
+		status   int
+		body     string
+	}{
+		{name: "static", method: "GET", url: "/health", status: 200, body: `"ok"`},
+		{name: "param", method: "GET", url: "/users/42", status: 200, body: `{"id":["42"]}`},
+		{name: "sub-router params", method: "GET", url: "/orgs/acme/users/7", status: 200, body: `{"orgID":["acme"],"userID":["7"]}`},
+		{name: "params and query", method: "GET", url: "/users/42?id=1&q=a", status: 200, body: `{"id":["42"],"q":["a"]}`},
+		{name: "catch-all", method: "GET", url: "/files/a/b.txt", status: 200, body: `"a/b.txt"`},
+		{name: "not found", method: "GET", url: "/missing", status: 404, body: `{"statusCode":404}`},
+		{name: "method not allowed", method: "DELETE", url: "/health", status: 405, body: `{"statusCode":405}`},
+		{name: "static next to param", fakeOnly: true, method: "GET", url: "/users/export", status: 200, body: `"export"`},
+	}
+	for _, backend := range backends {
+		r := NewRouter(backend.opts...)
+		r.NewLogger = func(c *Context) Logger { return &RecordingLogger{} }
+		r.NotFound(func(c *Context) error { return ErrNotFound })
+		r.MethodNotAllowed(func(c *Context) error { return NewError(http.StatusMethodNotAllowed, "") })
+		r.Get("/health", func(c *Context) error { c.Result = "ok"; return nil })
+		all := func(c *Context) error { c.Result = c.Params.All(); return nil }
+		r.Get("/users/:id", all)
+		r.SubRouter("/orgs/:orgID").Get("/users/:userID", all)
+		r.Get("/files/*filepath", func(c *Context) error { c.Result = c.Params.GetPath("filepath"); return nil })
+		if backend.name == "fake" {
+			r.Get("/users/export", func(c *Context) error { c.Result = "export"; return nil })
+		}
+		for _, test := range tests {
+			if test.fakeOnly && backend.name != "fake" {
+				continue
+			}
+			t.Run(backend.name+"/"+test.name, func(t *testing.T) {
+				w := serveRequest(r, test.method, test.url, nil)
+				if w.Code != test.status {
+					t.Fatalf("expected status %d, got %d", test.status, w.Code)
+				}
+				if body := strings.TrimSpace(w.Body.String()); body != test.body {
+					t.Errorf("expected body %s, got %s", test.body, body)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package milk
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Bind decodes the body of the request into dst based on the request's Content-Type.
+// JSON bodies (and bodies without a Content-Type) are decoded by ParseBody. Form-urlencoded and multipart
+// bodies are mapped onto the fields of dst, which must be a pointer to a struct, by the fields' `form:"name"` tags.
+// File parts of multipart bodies are not bound; use FormFile and ParsePart to read them.
+// Form values are converted to the type of the field; string, bool, integer, float and time.Time
+// (parsed by the router's DateFormats) fields are supported, as well as pointers to and slices of these.
+// Values that can't be converted result in a ValidationError with ErrCodeSyntaxError for each field.
+// Other content types result in ErrUnsupportedMediaType.
+func (this *Context) Bind(dst interface{}) error {
+	mediaType, _, _ := mime.ParseMediaType(this.R.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json":
+		return this.ParseBody(dst)
+	case "application/x-www-form-urlencoded":
+		this.R.Body = http.MaxBytesReader(this.w.w, this.R.Body, this.maxBodySize())
+		if err := this.R.ParseForm(); err != nil {
+			return this.bodyError(err)
+		}
+		return bind(dst, "form", false, this.Params.layouts(), func(key string) []string { return this.R.PostForm[key] })
+	case "multipart/form-data":
+		if err := this.ParseMultipart(DefaultMultipartMemory); err != nil {
+			return err
+		}
+		return bind(dst, "form", false, this.Params.layouts(), func(key string) []string { return this.R.MultipartForm.Value[key] })
+	default:
+		return ErrUnsupportedMediaType
+	}
+}
+
+// BindQuery maps the query string parameters of the request onto the fields of dst, a pointer to a struct,
+// by the fields' `query:"name"` tags. Values are converted as by Bind: slices get every value of repeated
+// parameters, and pointer fields are only set for parameters present in the query string, making them optional.
+// Values that can't be converted result in a single ValidationError with ErrCodeSyntaxError for each parameter.
+func (this *Context) BindQuery(dst interface{}) error {
+	query := this.Params.query()
+	return bind(dst, "query", false, this.Params.layouts(), func(key string) []string { return query[key] })
+}
+
+// BindParams maps the path parameters of the request onto the fields of dst, a pointer to a struct,
+// by the fields' `param:"name"` tags, e.g. `param:"id"` for a route registered as "/users/:id".
+// Values are converted as by BindQuery. Empty parameters result in a ValidationError with ErrCodeRequired.
+func (this *Context) BindParams(dst interface{}) error {
+	return bind(dst, "param", true, this.Params.layouts(), func(key string) []string {
+		if this.Params.p != nil {
+			if val := this.Params.p.ByName(key); val != "" {
+				return []string{val}
+			}
+		}
+		return nil
+	})
+}
+
+// BindRequest fills dst, a pointer to a struct, from the JSON body, the query string and the path parameters
+// of the request, in that order, so path parameters take precedence over query parameters, which take precedence
+// over the body. The body is skipped for requests without one. Errors binding the query string and path
+// parameters are combined into a single ValidationError. If dst is a Validator, it is validated once filled.
+func (this *Context) BindRequest(dst interface{}) error {
+	if this.R.Body != nil && this.R.Body != http.NoBody && this.R.ContentLength != 0 {
+		if err := this.parseBody(dst, this.maxBodySize()); err != nil {
+			return err
+		}
+	}
+	verr := NewValidationError()
+	for _, fn := range []func(interface{}) error{this.BindQuery, this.BindParams} {
+		if err := fn(dst); err != nil {
+			if e, ok := err.(*ValidationError); ok {
+				verr.Errors = append(verr.Errors, e.Errors...)
+			} else {
+				return err
+			}
+		}
+	}
+	if verr.HasErrors() {
+		return verr
+	}
+	return validate(dst)
+}
+
+// bind sets the fields of dst, a pointer to a struct, tagged with the given tag to the values returned
+// by lookup for the tag's name. Fields without any values are left untouched, or result in an error with
+// ErrCodeRequired if required is set or the tag has the required option, as in `param:"id,required"`.
+// The fields of tagged struct fields are bound with the tag's name and a dot as prefix, e.g. "page.limit",
+// and those of embedded structs without a tag without a prefix. Dates are parsed by the first of layouts matching them.
+func bind(dst interface{}, tag string, required bool, layouts []string, lookup func(key string) []string) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("milk: bind destination must be a pointer to a struct, got %T", dst)
+	}
+	verr := NewValidationError()
+	bindStruct(v.Elem(), "", tag, required, layouts, lookup, verr)
+	if verr.HasErrors() {
+		return verr
+	}
+	return nil
+}
+
+// bindStruct binds the fields of the struct v as described by bind, adding any errors to verr.
+func bindStruct(v reflect.Value, prefix string, tag string, required bool, layouts []string, lookup func(key string) []string, verr *ValidationError) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get(tag), ",")
+		isStruct := field.Type.Kind() == reflect.Struct && field.Type != timeType
+		if field.PkgPath != "" && !(field.Anonymous && isStruct) || name == "-" {
+			// the exported fields of embedded structs of unexported types are still bound
+			continue
+		} else if name == "" && field.Anonymous && isStruct {
+			bindStruct(v.Field(i), prefix, tag, required, layouts, lookup, verr)
+			continue
+		} else if name == "" {
+			continue
+		}
+		key := prefix + name
+		if isStruct {
+			bindStruct(v.Field(i), key+".", tag, required, layouts, lookup, verr)
+		} else if vals := lookup(key); len(vals) > 0 {
+			if err := setValues(v.Field(i), vals, layouts); err != nil {
+				verr.AddErrorDetailed(key, ErrCodeSyntaxError, nil, "%v", err)
+			}
+		} else if required || opts == "required" {
+			verr.AddError(key, ErrCodeRequired)
+		}
+	}
+}
+
+// setValues sets v to vals converted to the type of v. Slices get every value, other types the first one.
+func setValues(v reflect.Value, vals []string, layouts []string) error {
+	switch {
+	case v.Kind() == reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValues(elem.Elem(), vals, layouts); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(v.Type(), len(vals), len(vals))
+		for i, val := range vals {
+			if err := setValue(slice.Index(i), val, layouts); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	default:
+		return setValue(v, vals[0], layouts)
+	}
+}
+
+// setValue sets v to s converted to the type of v, parsing dates by the first of layouts matching s.
+func setValue(v reflect.Value, s string, layouts []string) error {
+	if v.Type() == timeType {
+		for _, layout := range layouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("Expected a date in the format %s", strings.Join(layouts, " or "))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("Expected a boolean value")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("Expected an integer value")
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("Expected a non-negative integer value")
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("Expected a numeric value")
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("Unsupported field type %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package milk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type bindDates struct {
+	Form  time.Time `form:"d"`
+	Query time.Time `query:"d"`
+	Param time.Time `param:"d"`
+}
+
+// TestBindDateFormats serves requests to routers with different DateFormats concurrently, checking that every
+// way of reading dates uses the formats of the request's router.
+func TestBindDateFormats(t *testing.T) {
+	readers := map[string]func(c *Context) (time.Time, error){
+		"Bind": func(c *Context) (time.Time, error) {
+			var dst bindDates
+			return dst.Form, c.Bind(&dst)
+		},
+		"BindQuery": func(c *Context) (time.Time, error) {
+			var dst bindDates
+			return dst.Query, c.BindQuery(&dst)
+		},
+		"BindParams": func(c *Context) (time.Time, error) {
+			var dst bindDates
+			return dst.Param, c.BindParams(&dst)
+		},
+		"Params.Bind": func(c *Context) (time.Time, error) {
+			var dst bindDates
+			return dst.Param, c.Params.Bind(&dst)
+		},
+		"Headers": func(c *Context) (time.Time, error) {
+			return c.Headers().GetTimeE("X-Date")
+		},
+		"Cookies": func(c *Context) (time.Time, error) {
+			return c.Cookies().GetTimeE("d")
+		},
+	}
+	// register registers a route for each reader, responding with the date read
+	register := func(r *Router) {
+		for name, read := range readers {
+			read := read
+			r.Post("/"+strings.ToLower(strings.Replace(name, ".", "-", 1))+"/:d", func(c *Context) error {
+				t, err := read(c)
+				if err != nil {
+					return NewError(http.StatusBadRequest, err.Error())
+				}
+				c.Result = t.Format("2006-01-02")
+				return nil
+			})
+		}
+	}
+	newRouter := func(formats ...string) *Router {
+		r, _ := newTestRouter()
+		r.DateFormats = formats
+		register(r)
+		return r
+	}
+	european, dotted, defaults := newRouter("02.01.2006"), newRouter("2006.01.02", "2006-01-02"), newRouter()
+	register(dotted.SubRouter("/sub"))
+
+	tests := []struct {
+		name   string
+		router *Router
+		prefix string
+		value  string
+		status int
+	}{
+		{name: "european", router: european, value: "01.06.2021", status: 200},
+		{name: "european rejects other formats", router: european, value: "2021.06.01", status: 400},
+		{name: "dotted", router: dotted, value: "2021.06.01", status: 200},
+		{name: "dotted fallback", router: dotted, value: "2021-06-01", status: 200},
+		{name: "dotted rejects other formats", router: dotted, value: "01.06.2021", status: 400},
+		{name: "sub-router inherits", router: dotted, prefix: "/sub", value: "2021.06.01", status: 200},
+		{name: "default", router: defaults, value: "2021-06-01", status: 200},
+		{name: "default rejects other formats", router: defaults, value: "2021.06.01", status: 400},
+	}
+	var wg sync.WaitGroup
+	for _, test := range tests {
+		for name := range readers {
+			test, name := test, name
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				path := test.prefix + "/" + strings.ToLower(strings.Replace(name, ".", "-", 1)) + "/" + test.value
+				w := serveRequest(test.router, "POST", path+"?d="+url.QueryEscape(test.value), strings.NewReader("d="+url.QueryEscape(test.value)),
+					"Content-Type", "application/x-www-form-urlencoded", "X-Date", test.value, "Cookie", "d="+test.value)
+				if w.Code != test.status {
+					t.Errorf("%s, %s: expected status %d, got %d: %s", test.name, name, test.status, w.Code, w.Body.String())
+				} else if test.status == 200 && strings.TrimSpace(w.Body.String()) != `"2021-06-01"` {
+					t.Errorf("%s, %s: expected 2021-06-01, got %s", test.name, name, w.Body.String())
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+type bindUser struct {
+	Name   string   `json:"name" form:"name" query:"name" param:"name"`
+	Age    int      `json:"age" form:"age" query:"age"`
+	Tags   []string `json:"tags" form:"tag" query:"tag"`
+	Active *bool    `json:"active" form:"active" query:"active"`
+}
+
+// multipartBody returns a multipart/form-data body with the given name/value pairs and its content type.
+func multipartBody(t *testing.T, values ...string) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for i := 0; i+1 < len(values); i += 2 {
+		if err := mw.WriteField(values[i], values[i+1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func TestBind(t *testing.T) {
+	form, formType := multipartBody(t, "name", "ann", "age", "30", "tag", "a", "tag", "b", "active", "true")
+	badForm, badFormType := multipartBody(t, "name", "ann", "age", "old")
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		status      int
+		body2       string
+	}{
+		{
+			name: "json", body: `{"name":"ann","age":30,"tags":["a","b"],"active":true}`, contentType: "application/json; charset=utf-8",
+			status: 200,
+		},
+		{name: "json without content type", body: `{"name":"ann","age":30,"tags":["a","b"],"active":true}`, status: 200},
+		{
+			name: "form", body: "name=ann&age=30&tag=a&tag=b&active=true", contentType: "application/x-www-form-urlencoded",
+			status: 200,
+		},
+		{name: "multipart", body: form.String(), contentType: formType, status: 200},
+		{name: "form conversion error", body: "name=ann&age=old", contentType: "application/x-www-form-urlencoded", status: 422},
+		{name: "multipart conversion error", body: badForm.String(), contentType: badFormType, status: 422},
+		{name: "unsupported content type", body: "ann", contentType: "text/plain", status: 415},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Post("/x", func(c *Context) error {
+				var user bindUser
+				if err := c.Bind(&user); err != nil {
+					return err
+				}
+				c.Result = user
+				return nil
+			})
+			var header []string
+			if test.contentType != "" {
+				header = []string{"Content-Type", test.contentType}
+			}
+			w := serveRequest(r, "POST", "/x", strings.NewReader(test.body), header...)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			want := `{"name":"ann","age":30,"tags":["a","b"],"active":true}`
+			if test.status == 200 && strings.TrimSpace(w.Body.String()) != want {
+				t.Errorf("expected %s, got %s", want, w.Body)
+			}
+			if test.status == 422 {
+				if got := fieldErrors(t, w.Body.String()); len(got) != 1 || got[0] != "age syntax-error" {
+					t.Errorf("expected an error for age, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+type bindPage struct {
+	Limit  int `query:"limit"`
+	Offset int `query:"offset"`
+}
+
+type bindFilter struct {
+	Status string `query:"status"`
+}
+
+type bindSearch struct {
+	bindFilter
+	Query    string    `query:"q,required"`
+	Page     bindPage  `query:"page"`
+	IDs      []int     `query:"id"`
+	Min      *float64  `query:"min"`
+	Since    time.Time `query:"since"`
+	Ignored  string    `query:"-"`
+	Untagged string
+	secret   string `query:"secret"`
+}
+
+func TestBindQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		want   string
+		errors []string
+	}{
+		{name: "required only", query: "q=milk", want: "milk 0 0 [] none 0001-01-01 "},
+		{
+			name:  "every field",
+			query: "q=milk&page.limit=10&page.offset=20&id=1&id=2&min=1.5&since=2021-06-01&status=open&Ignored=x&Untagged=x&secret=x",
+			want:  "milk 10 20 [1 2] 1.5 2021-06-01 open",
+		},
+		{name: "missing required", query: "page.limit=10", errors: []string{"q required"}},
+		{
+			name:   "every failure",
+			query:  "page.limit=ten&id=1&id=x&min=low&since=yesterday",
+			errors: []string{"q required", "page.limit syntax-error", "id syntax-error", "min syntax-error", "since syntax-error"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Get("/x", func(c *Context) error {
+				var s bindSearch
+				if err := c.BindQuery(&s); err != nil {
+					return err
+				}
+				if s.Ignored != "" || s.Untagged != "" || s.secret != "" {
+					t.Errorf("expected untagged, ignored and unexported fields to be skipped, got %+v", s)
+				}
+				min := "none"
+				if s.Min != nil {
+					min = fmt.Sprint(*s.Min)
+				}
+				c.Result = fmt.Sprintf("%s %d %d %v %s %s %s", s.Query, s.Page.Limit, s.Page.Offset, s.IDs, min, s.Since.Format("2006-01-02"), s.Status)
+				return nil
+			})
+			w := serveRequest(r, "GET", "/x?"+test.query, nil)
+			if test.errors != nil {
+				if w.Code != 422 {
+					t.Fatalf("expected status 422, got %d: %s", w.Code, w.Body)
+				}
+				if got := fieldErrors(t, w.Body.String()); strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected errors %q, got %q", test.errors, got)
+				}
+				return
+			}
+			if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `"`+test.want+`"` {
+				t.Errorf("expected %q, got %d %s", test.want, w.Code, w.Body)
+			}
+		})
+	}
+
+	t.Run("invalid destination", func(t *testing.T) {
+		r, _ := newTestRouter()
+		var err error
+		r.Get("/x", func(c *Context) error { err = c.BindQuery(bindSearch{}); return nil })
+		serveRequest(r, "GET", "/x", nil)
+		if err == nil || !strings.Contains(err.Error(), "pointer to a struct") {
+			t.Errorf("expected an error for a non-pointer destination, got %v", err)
+		}
+	})
+}
+
+type bindRoute struct {
+	OrgID  int    `param:"org"`
+	UserID uint   `param:"user"`
+	Tab    string `param:"tab,required"`
+}
+
+func TestBindParams(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  string
+		url    string
+		want   string
+		errors []string
+	}{
+		{name: "every param", route: "/orgs/:org/users/:user/:tab", url: "/orgs/1/users/2/posts", want: "1 2 posts"},
+		{name: "conversion errors", route: "/orgs/:org/users/:user/:tab", url: "/orgs/x/users/-2/posts", errors: []string{"org syntax-error", "user syntax-error"}},
+		{name: "params missing from the route", route: "/orgs/:org", url: "/orgs/1", errors: []string{"user required", "tab required"}},
+		{name: "empty catch-all", route: "/orgs/:org/users/:user/*tab", url: "/orgs/1/users/2/", want: "1 2 /"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Get(test.route, func(c *Context) error {
+				var p bindRoute
+				if err := c.BindParams(&p); err != nil {
+					return err
+				}
+				c.Result = fmt.Sprintf("%d %d %s", p.OrgID, p.UserID, p.Tab)
+				return nil
+			})
+			w := serveRequest(r, "GET", test.url, nil)
+			if test.errors != nil {
+				if got := fieldErrors(t, w.Body.String()); w.Code != 422 || strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected 422 with errors %q, got %d %q", test.errors, w.Code, got)
+				}
+				return
+			}
+			if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `"`+test.want+`"` {
+				t.Errorf("expected %q, got %d %s", test.want, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+type bindUpdate struct {
+	ID    int    `json:"id" param:"id"`
+	Name  string `json:"name" query:"name"`
+	Email string `json:"email"`
+	Limit int    `json:"limit" query:"limit"`
+}
+
+func (this *bindUpdate) Validate() *ValidationError {
+	verr := NewValidationError()
+	if this.Email == "" {
+		verr.AddError("email", ErrCodeRequired)
+	}
+	return verr
+}
+
+func TestBindRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		body   string
+		status int
+		want   string
+		errors []string
+	}{
+		{
+			name: "params override query override body", url: "/users/1?name=query",
+			body: `{"id":2,"name":"body","email":"a@b.c","limit":5}`, status: 200, want: "1 query a@b.c 5",
+		},
+		{name: "without body", url: "/users/1?name=query", status: 422, errors: []string{"email required"}},
+		{name: "malformed body", url: "/users/1", body: `{"id":`, status: 422, errors: []string{"body syntax-error"}},
+		{
+			name: "query and param errors combined", url: "/users/x?limit=y", body: `{"email":"a@b.c"}`,
+			status: 422, errors: []string{"limit syntax-error", "id syntax-error"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Put("/users/:id", func(c *Context) error {
+				var u bindUpdate
+				if err := c.BindRequest(&u); err != nil {
+					return err
+				}
+				c.Result = fmt.Sprintf("%d %s %s %d", u.ID, u.Name, u.Email, u.Limit)
+				return nil
+			})
+			var body io.Reader
+			if test.body != "" {
+				body = strings.NewReader(test.body)
+			}
+			w := serveRequest(r, "PUT", test.url, body)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if test.errors != nil {
+				if got := fieldErrors(t, w.Body.String()); strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected errors %q, got %q", test.errors, got)
+				}
+			} else if strings.TrimSpace(w.Body.String()) != `"`+test.want+`"` {
+				t.Errorf("expected %q, got %s", test.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package milk
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxBodySize is the maximum size in bytes of request bodies read by Context.ParseBody,
+// unless a different size is set on the router (see Router.MaxBodySize).
+var DefaultMaxBodySize int64 = 10 << 20
+
+// ErrBodyStreamed is returned by RawBody for routes whose body is streamed rather than buffered (see Route.StreamBody).
+var ErrBodyStreamed = errors.New("milk: request body is not buffered for streaming routes")
+
+// Validator is implemented by request payloads able to validate themselves. The ParseBody methods call
+// Validate after successfully decoding into a Validator, returning the ValidationError if it has errors.
+type Validator interface {
+	Validate() *ValidationError
+}
+
+// unknownFieldPrefix prefixes the message of errors returned by json.Decoder for unknown fields
+const unknownFieldPrefix = "json: unknown field "
+
+// ParseBody decodes the body of the request into dst, with the decoder registered for the request's
+// content type (see Router.RegisterDecoder), or as JSON.
+// Malformed JSON and values not matching the type of dst result in a ValidationError with
+// ErrCodeSyntaxError, keyed by the offending field (or "body" for syntax errors) and with the
+// offset of the error as data. Bodies a registered decoder fails to decode result in a ValidationError
+// keyed by "body", or in ErrUnsupportedMediaType if the decoder doesn't support the type of dst.
+// An empty body results in ErrBadRequest, and a body larger than the router's MaxBodySize in ErrRequestEntityTooLarge.
+func (this *Context) ParseBody(dst interface{}) error {
+	return this.ParseBodyMax(dst, this.maxBodySize())
+}
+
+// ParseBodyMax is like ParseBody, but limits the size of the body to maxSize bytes rather than
+// the router's MaxBodySize.
+func (this *Context) ParseBodyMax(dst interface{}, maxSize int64) error {
+	if err := this.parseBody(dst, maxSize); err != nil {
+		return err
+	}
+	return validate(dst)
+}
+
+// parseBody is ParseBodyMax without validating dst.
+// JSON bodies are decoded as they're read with NewJSONDecoder, unless only Unmarshal has been replaced.
+func (this *Context) parseBody(dst interface{}, maxSize int64) error {
+	body := http.MaxBytesReader(this.w.w, this.R.Body, maxSize)
+	dec := this.decoder()
+	if dec == nil && decodesJSON() {
+		if err := NewJSONDecoder(body).Decode(dst); err != nil {
+			return this.bodyError(err)
+		}
+		return nil
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return this.bodyError(err)
+	} else if len(bytes.TrimSpace(b)) == 0 {
+		return this.bodyError(io.EOF)
+	}
+	if dec != nil {
+		if err := dec(b, dst); err == ErrUnsupportedType {
+			return ErrUnsupportedMediaType
+		} else if err != nil {
+			this.Debugf("error parsing request body: %v", err)
+			verr := NewValidationError()
+			verr.AddErrorDetailed("body", ErrCodeSyntaxError, nil, "Invalid request body")
+			return verr
+		}
+	} else if err := Unmarshal(b, dst); err != nil {
+		return this.bodyError(err)
+	}
+	return nil
+}
+
+// MustParseBody is like ParseBody for JSON bodies, but reports every value in the body not matching the type
+// of dst instead of the first one. Each results in an error with ErrCodeSyntaxError in a single ValidationError,
+// keyed by the path of the value, e.g. "items[2].price", with a hint naming the expected type.
+func (this *Context) MustParseBody(dst interface{}) error {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(this.w.w, this.R.Body, this.maxBodySize()))
+	if err != nil {
+		return this.bodyError(err)
+	} else if len(bytes.TrimSpace(b)) == 0 {
+		return this.bodyError(io.EOF)
+	}
+	if err := Unmarshal(b, dst); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return this.bodyError(err)
+		}
+		this.Debugf("error parsing request body: %v", err)
+		verr := NewValidationError()
+		jsonTypeErrors(b, reflect.TypeOf(dst), verr)
+		if !verr.HasErrors() {
+			return this.bodyError(err)
+		}
+		return verr
+	}
+	return validate(dst)
+}
+
+// ParseBodyStrict is like ParseBody, but rejects bodies containing fields not present in dst and
+// bodies with content after the JSON value. Unknown fields result in a ValidationError with
+// ErrCodeSyntaxError keyed by the name of the field. The body is decoded with NewJSONDecoder.
+func (this *Context) ParseBodyStrict(dst interface{}) error {
+	dec := NewJSONDecoder(http.MaxBytesReader(this.w.w, this.R.Body, this.maxBodySize()))
+	if d, ok := dec.(interface{ DisallowUnknownFields() }); ok {
+		d.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dst); err != nil {
+		return this.bodyError(err)
+	}
+	var rest interface{}
+	if err := dec.Decode(&rest); err != io.EOF {
+		var offset interface{}
+		if d, ok := dec.(interface{ InputOffset() int64 }); ok {
+			offset = d.InputOffset()
+		}
+		verr := NewValidationError()
+		verr.AddErrorDetailed("body", ErrCodeSyntaxError, offset, "Unexpected content after JSON value")
+		return verr
+	}
+	return validate(dst)
+}
+
+// ParseBodyXML decodes the body of the request as XML into dst.
+// Malformed XML results in a ValidationError with ErrCodeSyntaxError keyed by "body", with the line
+// of the error as data. An empty body results in ErrBadRequest, and a body larger than the router's
+// MaxBodySize in ErrRequestEntityTooLarge.
+func (this *Context) ParseBodyXML(dst interface{}) error {
+	body := http.MaxBytesReader(this.w.w, this.R.Body, this.maxBodySize())
+	if err := xml.NewDecoder(body).Decode(dst); err != nil {
+		var syntaxErr *xml.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			this.Debugf("error parsing request body: %v", err)
+			verr := NewValidationError()
+			verr.AddErrorDetailed("body", ErrCodeSyntaxError, syntaxErr.Line, "Invalid XML on line %d: %s", syntaxErr.Line, syntaxErr.Msg)
+			return verr
+		}
+		return this.bodyError(err)
+	}
+	return validate(dst)
+}
+
+// RawBody returns the raw body of the request. The body is read once and cached on the context, and R.Body
+// is reset to read the cached bytes, so the body can still be parsed by later handlers, e.g. after
+// a middleware has verified a signature of the raw body. The body is limited to the router's MaxBodySize.
+// For routes registered with Route.StreamBody, RawBody returns ErrBodyStreamed.
+func (this *Context) RawBody() ([]byte, error) {
+	if this.rawBody != nil {
+		return this.rawBody, nil
+	} else if this.streamBody {
+		return nil, ErrBodyStreamed
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(this.w.w, this.R.Body, this.maxBodySize()))
+	if err != nil {
+		return nil, this.bodyError(err)
+	}
+	this.rawBody = b
+	this.R.Body = ioutil.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+
+// validate validates dst if it is a Validator, returning its ValidationError if it has any errors.
+func validate(dst interface{}) error {
+	if v, ok := dst.(Validator); ok {
+		if verr := v.Validate(); verr != nil && verr.HasErrors() {
+			return verr
+		}
+	}
+	return nil
+}
+
+// MaxBodySize returns middleware limiting the size of request bodies to maxSize bytes, for routes that
+// read the body themselves. Requests declaring a larger Content-Length are rejected with
+// ErrRequestEntityTooLarge before any later handlers run; reading beyond maxSize from other bodies fails.
+func MaxBodySize(maxSize int64) HandlerFunc {
+	return func(c *Context) error {
+		if c.R.ContentLength > maxSize {
+			return ErrRequestEntityTooLarge
+		}
+		c.R.Body = http.MaxBytesReader(c.w.w, c.R.Body, maxSize)
+		return nil
+	}
+}
+
+// decoder returns the decoder registered for the content type of the request, or nil for JSON.
+func (this *Context) decoder() Decoder {
+	if this.router == nil {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(this.R.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	return this.router.decoder(mediaType)
+}
+
+func (this *Context) maxBodySize() int64 {
+	if this.router != nil {
+		return this.router.maxBodySize()
+	}
+	return DefaultMaxBodySize
+}
+
+// bodyError converts an error decoding the request body into the error returned to the client.
+func (this *Context) bodyError(err error) error {
+	this.Debugf("error parsing request body: %v", err)
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var sizeErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &sizeErr):
+		return ErrRequestEntityTooLarge
+	case err == io.EOF:
+		return ErrBadRequest
+	case err == io.ErrUnexpectedEOF:
+		verr := NewValidationError()
+		verr.AddErrorDetailed("body", ErrCodeSyntaxError, nil, "Unexpected end of JSON input")
+		return verr
+	case errors.As(err, &syntaxErr):
+		verr := NewValidationError()
+		verr.AddErrorDetailed("body", ErrCodeSyntaxError, syntaxErr.Offset, "Invalid JSON at offset %d: %v", syntaxErr.Offset, syntaxErr)
+		return verr
+	case errors.As(err, &typeErr):
+		verr := NewValidationError()
+		verr.AddErrorDetailed(typeErr.Field, ErrCodeSyntaxError, typeErr.Offset, "Expected a value of type %v, got %s", typeErr.Type, typeErr.Value)
+		return verr
+	case strings.HasPrefix(err.Error(), unknownFieldPrefix):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownFieldPrefix))
+		verr := NewValidationError()
+		verr.AddErrorDetailed(field, ErrCodeSyntaxError, nil, "Unknown field %q", field)
+		return verr
+	default:
+		return fmt.Errorf("error reading request body: %v", err)
+	}
+}
@@ -0,0 +1,503 @@
+package milk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// hookRecorder replaces the JSON hooks with encoding/json wrappers recording which hooks are called.
+type hookRecorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (this *hookRecorder) record(hook string) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.calls = append(this.calls, hook)
+}
+
+func (this *hookRecorder) called(hook string) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, call := range this.calls {
+		if call == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// install replaces Marshal and Unmarshal, and the streaming hooks as well if streaming is set, returning a func
+// restoring the defaults.
+func (this *hookRecorder) install(streaming bool) func() {
+	marshal, unmarshal, newEncoder, newDecoder := Marshal, Unmarshal, NewJSONEncoder, NewJSONDecoder
+	Marshal = func(v interface{}) ([]byte, error) {
+		this.record("Marshal")
+		return json.Marshal(v)
+	}
+	Unmarshal = func(data []byte, v interface{}) error {
+		this.record("Unmarshal")
+		return json.Unmarshal(data, v)
+	}
+	if streaming {
+		NewJSONEncoder = func(w io.Writer) JSONEncoder {
+			this.record("NewJSONEncoder")
+			return json.NewEncoder(w)
+		}
+		NewJSONDecoder = func(r io.Reader) JSONDecoder {
+			this.record("NewJSONDecoder")
+			return json.NewDecoder(r)
+		}
+	}
+	return func() {
+		Marshal, Unmarshal, NewJSONEncoder, NewJSONDecoder = marshal, unmarshal, newEncoder, newDecoder
+	}
+}
+
+type hookItem struct {
+	Name string `json:"name"`
+}
+
+func TestJSONHooks(t *testing.T) {
+	tests := []struct {
+		name      string
+		streaming bool // replace NewJSONEncoder and NewJSONDecoder as well as Marshal and Unmarshal
+		method    string
+		url       string
+		body      string
+		handler   HandlerFunc
+		status    int
+		hook      string
+	}{
+		{
+			name: "streamed result", streaming: true, method: "GET", url: "/x",
+			handler: func(c *Context) error { c.Result = hookItem{"a"}; return nil },
+			status:  200, hook: "NewJSONEncoder",
+		},
+		{
+			name: "result with only Marshal replaced", method: "GET", url: "/x",
+			handler: func(c *Context) error { c.Result = hookItem{"a"}; return nil },
+			status:  200, hook: "Marshal",
+		},
+		{
+			name: "pretty printed result", streaming: true, method: "GET", url: "/x?pretty",
+			handler: func(c *Context) error { c.Result = hookItem{"a"}; return nil },
+			status:  200, hook: "Marshal",
+		},
+		{
+			name: "error payload", streaming: true, method: "GET", url: "/x",
+			handler: func(c *Context) error { return NewError(409, "conflict") },
+			status:  409, hook: "NewJSONEncoder",
+		},
+		{
+			name: "error payload with only Marshal replaced", method: "GET", url: "/x",
+			handler: func(c *Context) error { return NewError(409, "conflict") },
+			status:  409, hook: "Marshal",
+		},
+		{
+			name: "validation error payload", method: "GET", url: "/x",
+			handler: func(c *Context) error {
+				verr := NewValidationError()
+				verr.AddError("name", ErrCodeRequired)
+				return verr
+			},
+			status: StatusValidationError, hook: "Marshal",
+		},
+		{
+			name: "JSON", streaming: true, method: "GET", url: "/x",
+			handler: func(c *Context) error { return c.JSON(200, hookItem{"a"}) },
+			status:  200, hook: "Marshal",
+		},
+		{
+			name: "ParseBody", streaming: true, method: "POST", url: "/x", body: `{"name":"a"}`,
+			handler: func(c *Context) error { return c.ParseBody(&hookItem{}) },
+			status:  200, hook: "NewJSONDecoder",
+		},
+		{
+			name: "ParseBody with only Unmarshal replaced", method: "POST", url: "/x", body: `{"name":"a"}`,
+			handler: func(c *Context) error { return c.ParseBody(&hookItem{}) },
+			status:  200, hook: "Unmarshal",
+		},
+		{
+			name: "ParseBodyStrict", streaming: true, method: "POST", url: "/x", body: `{"name":"a"}`,
+			handler: func(c *Context) error { return c.ParseBodyStrict(&hookItem{}) },
+			status:  200, hook: "NewJSONDecoder",
+		},
+		{
+			name: "MustParseBody", streaming: true, method: "POST", url: "/x", body: `{"name":"a"}`,
+			handler: func(c *Context) error { return c.MustParseBody(&hookItem{}) },
+			status:  200, hook: "Unmarshal",
+		},
+		{
+			name: "GetJSON", streaming: true, method: "GET", url: `/x?f={"name":"a"}`,
+			handler: func(c *Context) error { return c.Params.GetJSON("f", &hookItem{}) },
+			status:  200, hook: "Unmarshal",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := &hookRecorder{}
+			defer rec.install(test.streaming)()
+			r, _ := newTestRouter()
+			r.Get("/x", test.handler)
+			r.Post("/x", test.handler)
+			w := serveRequest(r, test.method, strings.ReplaceAll(test.url, `"`, "%22"), strings.NewReader(test.body), "Content-Type", "application/json")
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if !rec.called(test.hook) {
+				t.Errorf("expected %s to be called, got %v", test.hook, rec.calls)
+			}
+		})
+	}
+}
+
+func TestParseBodyStrict(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		key    string
+	}{
+		{name: "valid", body: `{"name":"a"}`, status: 200},
+		{name: "trailing whitespace", body: "{\"name\":\"a\"}\n", status: 200},
+		{name: "unknown field", body: `{"name":"a","age":1}`, status: StatusValidationError, key: "age"},
+		{name: "content after value", body: `{"name":"a"} {}`, status: StatusValidationError, key: "body"},
+		{name: "garbage after value", body: `{"name":"a"}]`, status: StatusValidationError, key: "body"},
+		{name: "empty body", body: "", status: 400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Post("/x", func(c *Context) error { return c.ParseBodyStrict(&hookItem{}) })
+			w := serveRequest(r, "POST", "/x", strings.NewReader(test.body))
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if test.key != "" && !strings.Contains(w.Body.String(), `"key":"`+test.key+`"`) {
+				t.Errorf("expected an error keyed by %s, got %s", test.key, w.Body.String())
+			}
+		})
+	}
+}
+
+// bodyItem is a request payload validating itself.
+type bodyItem struct {
+	Name  string `json:"name" xml:"name"`
+	Price int    `json:"price" xml:"price"`
+}
+
+func (this *bodyItem) Validate() *ValidationError {
+	verr := NewValidationError()
+	if this.Name == "" {
+		verr.AddError("name", ErrCodeRequired)
+	}
+	if this.Price < 0 {
+		verr.AddError("price", ErrCodeValueTooLow)
+	}
+	return verr
+}
+
+// fieldErrors returns the field errors of a validation error response as "key code data" strings.
+func fieldErrors(t *testing.T, body string) []string {
+	var res ValidationError
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		t.Fatalf("expected a validation error response, got %s", body)
+	}
+	var errs []string
+	for _, e := range res.Errors {
+		s := e.FieldName + " " + e.ErrorCode
+		if e.Data != nil {
+			s += " " + fmt.Sprint(e.Data)
+		}
+		errs = append(errs, s)
+	}
+	return errs
+}
+
+// parseBodyTest is a request parsed into a bodyItem by parse, or by ParseBody if parse is nil.
+type parseBodyTest struct {
+	name        string
+	parse       func(c *Context, dst *bodyItem) error
+	body        string
+	chunked     bool // chunked sends the body without a Content-Length
+	maxBodySize int64
+	status      int
+	errors      []string
+}
+
+// testParseBody serves the requests of tests, checking the statuses and field errors of the responses.
+func testParseBody(t *testing.T, tests []parseBodyTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.MaxBodySize = test.maxBodySize
+			parse := test.parse
+			if parse == nil {
+				parse = func(c *Context, dst *bodyItem) error { return c.ParseBody(dst) }
+			}
+			r.Post("/x", func(c *Context) error {
+				var item bodyItem
+				if err := parse(c, &item); err != nil {
+					return err
+				}
+				c.Result = item
+				return nil
+			})
+			req := httptest.NewRequest("POST", "/x", strings.NewReader(test.body))
+			if test.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if test.errors != nil {
+				if got := fieldErrors(t, w.Body.String()); strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected errors %q, got %q", test.errors, got)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBody(t *testing.T) {
+	testParseBody(t, []parseBodyTest{
+		{name: "valid", body: `{"name":"a","price":1}`, status: 200},
+		{name: "syntax error", body: `{"name":}`, status: 422, errors: []string{"body syntax-error 9"}},
+		{name: "type error", body: `{"name":"a","price":"x"}`, status: 422, errors: []string{"price syntax-error 23"}},
+		{name: "truncated", body: `{"name":"a"`, status: 422, errors: []string{"body syntax-error"}},
+		{name: "empty", body: "", status: 400},
+		{name: "whitespace", body: " \n", status: 400},
+	})
+}
+
+func TestParseBodyMaxSize(t *testing.T) {
+	testParseBody(t, []parseBodyTest{
+		{name: "too large", body: `{"name":"abcdefghij"}`, maxBodySize: 10, status: 413},
+		{name: "too large without content length", body: `{"name":"abcdefghij"}`, chunked: true, maxBodySize: 10, status: 413},
+		{
+			name:  "larger than the limit of the call",
+			parse: func(c *Context, dst *bodyItem) error { return c.ParseBodyMax(dst, 5) },
+			body:  `{"name":"a"}`, status: 413,
+		},
+	})
+}
+
+func TestParseBodyXML(t *testing.T) {
+	testParseBody(t, []parseBodyTest{
+		{
+			name:  "xml",
+			parse: func(c *Context, dst *bodyItem) error { return c.ParseBodyXML(dst) },
+			body:  "<item><name>a</name><price>1</price></item>", status: 200,
+		},
+		{
+			name:  "malformed xml",
+			parse: func(c *Context, dst *bodyItem) error { return c.ParseBodyXML(dst) },
+			body:  "<item>\n<name>a</nam></item>", status: 422, errors: []string{"body syntax-error 2"},
+		},
+	})
+}
+
+func TestParseBodyValidation(t *testing.T) {
+	testParseBody(t, []parseBodyTest{
+		{name: "invalid", body: `{"name":"","price":-1}`, status: 422, errors: []string{"name required", "price value-too-low"}},
+		{
+			name:  "invalid xml",
+			parse: func(c *Context, dst *bodyItem) error { return c.ParseBodyXML(dst) },
+			body:  "<item><price>-1</price></item>", status: 422, errors: []string{"name required", "price value-too-low"},
+		},
+	})
+}
+
+func TestMaxBodySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		status  int
+		runs    bool
+	}{
+		{name: "small body", body: "abc", status: 200, runs: true},
+		{name: "declared too large", body: "abcdefghij", status: 413},
+		{name: "streamed too large", body: "abcdefghij", chunked: true, status: 413, runs: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var runs bool
+			r.Post("/upload", MaxBodySize(5), func(c *Context) error {
+				runs = true
+				if _, err := io.ReadAll(c.R.Body); err != nil {
+					return c.bodyError(err)
+				}
+				return nil
+			})
+			req := httptest.NewRequest("POST", "/upload", strings.NewReader(test.body))
+			if test.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Errorf("expected status %d, got %d", test.status, w.Code)
+			}
+			if runs != test.runs {
+				t.Errorf("expected the handler to run: %v, got %v", test.runs, runs)
+			}
+		})
+	}
+}
+
+func TestBodyTooLargeClosesConnection(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(r *Router)
+	}{
+		{
+			name: "router limit",
+			setup: func(r *Router) {
+				r.MaxBodySize = 5
+				r.Post("/upload", func(c *Context) error { _, err := c.RawBody(); return err })
+			},
+		},
+		{
+			name: "middleware",
+			setup: func(r *Router) {
+				r.Post("/upload", MaxBodySize(5), func(c *Context) error {
+					if _, err := io.ReadAll(c.R.Body); err != nil {
+						return c.bodyError(err)
+					}
+					return nil
+				})
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			test.setup(r)
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			req, _ := http.NewRequest("POST", server.URL+"/upload", strings.NewReader("abcdefghij"))
+			req.ContentLength = -1
+			res, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+			if res.StatusCode != 413 {
+				t.Errorf("expected status 413, got %d", res.StatusCode)
+			}
+			if !res.Close {
+				t.Errorf("expected the server to close the connection")
+			}
+		})
+	}
+}
+
+func TestRawBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool
+		status int
+		body   string
+	}{
+		{name: "buffered", status: 200, body: `{"name":"a","price":1}`},
+		{name: "streamed", stream: true, status: 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var raw []string
+			verify := func(c *Context) error {
+				for i := 0; i < 2; i++ {
+					b, err := c.RawBody()
+					if err != nil {
+						return err
+					}
+					raw = append(raw, string(b))
+				}
+				return nil
+			}
+			route := r.Post("/x", verify, func(c *Context) error {
+				var item bodyItem
+				if err := c.ParseBody(&item); err != nil {
+					return err
+				}
+				c.Result = item
+				return nil
+			})
+			if test.stream {
+				route.StreamBody()
+			}
+			body := `{"name":"a","price":1}`
+			w := serveRequest(r, "POST", "/x", strings.NewReader(body))
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if test.stream {
+				return
+			}
+			if strings.TrimSpace(w.Body.String()) != test.body {
+				t.Errorf("expected the body to be parsed after reading it raw, got %s", w.Body)
+			}
+			if len(raw) != 2 || raw[0] != body || raw[1] != body {
+				t.Errorf("expected the raw body twice, got %q", raw)
+			}
+		})
+	}
+}
+
+func TestMustParseBody(t *testing.T) {
+	type line struct {
+		Price int `json:"price"`
+	}
+	type order struct {
+		Name  string           `json:"name"`
+		Lines []line           `json:"lines"`
+		Tags  map[string]bool  `json:"tags"`
+		Meta  struct{ ID int } `json:"meta"`
+	}
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		errors []string
+	}{
+		{name: "valid", body: `{"name":"a","lines":[{"price":1}],"tags":{"x":true},"meta":{"ID":1}}`, status: 200},
+		{
+			name:   "every type error",
+			body:   `{"name":5,"lines":[{"price":"1"},{"price":2},{"price":true}],"tags":{"x":"yes"},"meta":{"ID":"1"}}`,
+			status: 422,
+			errors: []string{"lines[0].price syntax-error", "lines[2].price syntax-error", "meta.ID syntax-error", "name syntax-error", "tags.x syntax-error"},
+		},
+		{name: "array instead of object", body: `{"lines":{"price":1}}`, status: 422, errors: []string{"lines syntax-error"}},
+		{name: "syntax error", body: `{"name":`, status: 422, errors: []string{"body syntax-error 8"}},
+		{name: "empty", body: "", status: 400},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Post("/x", func(c *Context) error { return c.MustParseBody(&order{}) })
+			w := serveRequest(r, "POST", "/x", strings.NewReader(test.body))
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if test.errors != nil {
+				if got := fieldErrors(t, w.Body.String()); strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected errors %q, got %q", test.errors, got)
+				}
+			}
+		})
+	}
+}
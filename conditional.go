@@ -0,0 +1,77 @@
+package milk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag sets the entity tag of a successful response, e.g. a version number of the resource, and adds it as
+// the ETag header. Unquoted values are quoted. If the request's If-None-Match header matches the tag,
+// a 304 response is sent without encoding the Result. It takes precedence over the ETags of the router.
+func (this *Context) ETag(value string) {
+	if !strings.HasSuffix(value, `"`) {
+		value = `"` + value + `"`
+	}
+	this.etag = value
+}
+
+// LastModified sets the time the resource of a successful response was last modified, and adds it as the
+// Last-Modified header. If the request's If-Modified-Since header is equal to or later than t, truncated to
+// seconds, a 304 response is sent without encoding the Result. If-Modified-Since is ignored for requests
+// with an If-None-Match header, which is matched against the ETag instead.
+func (this *Context) LastModified(t time.Time) {
+	this.lastModified = t
+}
+
+// computesETag reports whether the ETag of a response with the given status code is computed from its body.
+func (this *Context) computesETag(statusCode int) bool {
+	return statusCode == http.StatusOK && this.etag == "" && this.router != nil && this.router.etags()
+}
+
+// notModified sets the ETag header to etag, if any, and the Last-Modified header, if set, and reports whether
+// the request's conditional headers show that the client's cached copy of the response is current.
+func (this *Context) notModified(etag string) bool {
+	h := this.W.Header()
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	if !this.lastModified.IsZero() {
+		h.Set("Last-Modified", this.lastModified.UTC().Format(http.TimeFormat))
+	}
+	if inm := this.R.Header.Get("If-None-Match"); inm != "" {
+		return etag != "" && etagMatch(inm, etag)
+	}
+	if this.lastModified.IsZero() || (this.R.Method != "GET" && this.R.Method != "HEAD") {
+		return false
+	}
+	since, err := http.ParseTime(this.R.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// the header has a resolution of seconds
+	return !this.lastModified.Truncate(time.Second).After(since)
+}
+
+// bodyETag returns a strong entity tag for a response body.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch reports whether any tag of an If-None-Match header matches etag, using weak comparison.
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
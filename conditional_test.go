@@ -0,0 +1,143 @@
+package milk
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETags(t *testing.T) {
+	body := `{"id":1}`
+	computed := bodyETag([]byte(body))
+	tests := []struct {
+		name        string
+		etags       bool
+		handler     HandlerFunc
+		method      string
+		ifNoneMatch string
+		status      int
+		etag        string
+	}{
+		{name: "disabled", handler: func(c *Context) error { c.Result = map[string]int{"id": 1}; return nil }, status: 200},
+		{name: "computed", etags: true, handler: func(c *Context) error { c.Result = map[string]int{"id": 1}; return nil }, status: 200, etag: computed},
+		{
+			name: "computed and matching", etags: true, ifNoneMatch: computed,
+			handler: func(c *Context) error { c.Result = map[string]int{"id": 1}; return nil }, status: 304, etag: computed,
+		},
+		{
+			name: "computed and matching weakly", etags: true, ifNoneMatch: `"other", W/` + computed,
+			handler: func(c *Context) error { c.Result = map[string]int{"id": 1}; return nil }, status: 304, etag: computed,
+		},
+		{
+			name: "computed and stale", etags: true, ifNoneMatch: `"stale"`,
+			handler: func(c *Context) error { c.Result = map[string]int{"id": 1}; return nil }, status: 200, etag: computed,
+		},
+		{
+			name: "explicit", etags: true,
+			handler: func(c *Context) error { c.ETag("v7"); c.Result = map[string]int{"id": 1}; return nil }, status: 200, etag: `"v7"`,
+		},
+		{
+			name: "explicit and matching", ifNoneMatch: `"v7"`,
+			handler: func(c *Context) error { c.ETag("v7"); c.Result = map[string]int{"id": 1}; return nil }, status: 304, etag: `"v7"`,
+		},
+		{
+			name: "explicit weak tag matching", ifNoneMatch: `"v7"`,
+			handler: func(c *Context) error { c.ETag(`W/"v7"`); c.Result = map[string]int{"id": 1}; return nil }, status: 304, etag: `W/"v7"`,
+		},
+		{
+			name: "wildcard", ifNoneMatch: "*",
+			handler: func(c *Context) error { c.ETag("v7"); c.Result = map[string]int{"id": 1}; return nil }, status: 304, etag: `"v7"`,
+		},
+		{
+			name: "head", etags: true, method: "HEAD", ifNoneMatch: computed,
+			handler: func(c *Context) error { c.Result = map[string]int{"id": 1}; return nil }, status: 304, etag: computed,
+		},
+		{
+			name: "error", etags: true, ifNoneMatch: `"v7"`,
+			handler: func(c *Context) error { c.ETag("v7"); return ErrNotFound }, status: 404,
+		},
+		{
+			name: "created", etags: true,
+			handler: func(c *Context) error { c.Created("/x/1", map[string]int{"id": 1}); return nil }, status: 201,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.ETags = test.etags
+			method := test.method
+			if method == "" {
+				method = "GET"
+			}
+			r.route(method, "/x", test.handler)
+			var header []string
+			if test.ifNoneMatch != "" {
+				header = []string{"If-None-Match", test.ifNoneMatch}
+			}
+			w := serveRequest(r, method, "/x", nil, header...)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if got := w.Header().Get("ETag"); got != test.etag {
+				t.Errorf("expected ETag %q, got %q", test.etag, got)
+			}
+			if w.Code == 304 && (w.Body.Len() > 0 || w.Header().Get("Content-Type") != "") {
+				t.Errorf("expected a 304 without body or content type, got %q %q", w.Header().Get("Content-Type"), w.Body)
+			}
+			if w.Code == 200 && method == "GET" && strings.TrimSpace(w.Body.String()) != body {
+				t.Errorf("expected body %s, got %s", body, w.Body)
+			}
+		})
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	modified := time.Date(2021, 6, 1, 12, 30, 15, 500, time.FixedZone("CEST", 2*60*60))
+	header := "Tue, 01 Jun 2021 10:30:15 GMT"
+	tests := []struct {
+		name     string
+		method   string
+		header   []string
+		err      error
+		status   int
+		modified string
+	}{
+		{name: "unconditional", status: 200, modified: header},
+		{name: "not modified", header: []string{"If-Modified-Since", header}, status: 304, modified: header},
+		{name: "later", header: []string{"If-Modified-Since", "Wed, 02 Jun 2021 00:00:00 GMT"}, status: 304, modified: header},
+		{name: "modified", header: []string{"If-Modified-Since", "Tue, 01 Jun 2021 10:30:14 GMT"}, status: 200, modified: header},
+		{name: "malformed header", header: []string{"If-Modified-Since", "yesterday"}, status: 200, modified: header},
+		{name: "head", method: "HEAD", header: []string{"If-Modified-Since", header}, status: 304, modified: header},
+		{name: "post", method: "POST", header: []string{"If-Modified-Since", header}, status: 200, modified: header},
+		{
+			name:   "if-none-match takes precedence",
+			header: []string{"If-Modified-Since", header, "If-None-Match", `"other"`}, status: 200, modified: header,
+		},
+		{name: "error", header: []string{"If-Modified-Since", header}, err: ErrForbidden, status: 403},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			method := test.method
+			if method == "" {
+				method = "GET"
+			}
+			r.route(method, "/x", func(c *Context) error {
+				c.LastModified(modified)
+				c.Result = "doc"
+				return test.err
+			})
+			w := serveRequest(r, method, "/x", nil, test.header...)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if got := w.Header().Get("Last-Modified"); got != test.modified {
+				t.Errorf("expected Last-Modified %q, got %q", test.modified, got)
+			}
+			if _, err := http.ParseTime(w.Header().Get("Last-Modified")); test.modified != "" && err != nil {
+				t.Errorf("expected an HTTP date, got %v", err)
+			}
+		})
+	}
+}
@@ -1,13 +1,18 @@
 package milk
 
 import (
+	"bufio"
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/julienschmidt/httprouter"
-	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type Event int
@@ -38,6 +43,13 @@ func (this Errors) Error() string {
 	}
 }
 
+// Unwrap returns the errors, so errors.Is and errors.As match any of them.
+func (this Errors) Unwrap() []error {
+	return this
+}
+
+// Context carries a request, its response and parameters through the chain of handlers. A Context is only
+// valid until its request has been served: contexts are reused by later requests, so they must not be retained.
 type Context struct {
 	context.Context
 
@@ -50,51 +62,181 @@ type Context struct {
 	// Result holds the data to be returned to the client
 	Result interface{}
 
+	// ResponseFormat is the format the result is encoded in. By default it is negotiated from the Accept header
+	// among the encoders registered on the router.
+	ResponseFormat Format
+
 	// Params holds the parameters of the url and querystring of the context's request.
 	Params *Params
 
 	// Values holds context specific values
-	Values Values
+	Values *Values
 
 	w *responseWriter // w is a responseWriter wrapping W
 
+	router *Router // router is the router serving the request
+	logger Logger  // logger is the logger of the request, see log()
+
+	status     int    // status is the status code of successful responses set by SetStatus
+	rawBody    []byte // rawBody caches the request body read by RawBody
+	streamBody bool   // streamBody is set for routes whose body must not be buffered by RawBody
+	jsonp      bool   // jsonp is set for routes supporting JSONP
+
+	etag         string    // etag is the entity tag of the response set with ETag
+	lastModified time.Time // lastModified is the modification time of the response set with LastModified
+
+	negotiated bool     // negotiated is set once the encoder of the response has been negotiated
+	enc        *encoder // enc is the negotiated encoder, or nil if the client accepts none
+
+	pattern  string        // pattern is the path pattern of the route matched by the request
 	handlers []HandlerFunc // handlers is a slice of registered handlers to be run for the current request
 	index    int           // index is the index of the current handler being processed in the handlers slice
 
-	errs Errors
+	errs  Errors // errs holds all errors, whether returned by handlers or recorded with Error()
+	fatal Errors // fatal holds the errors returned by handlers, which determine the error response
+
+	events   map[Event][]func(*Context)
+	deferred []func(*Context) // deferred holds the functions registered with Defer()
 
-	events map[Event][]func(*Context)
+	rw       *responseWriter // rw, params and values are kept for reuse when the context is released
+	params   *Params
+	values   *Values
+	detached bool // detached is set when handlers may still use the context after the request has been served
 }
 
-func newContext(c context.Context, r *http.Request, w http.ResponseWriter, p httprouter.Params, handlers []HandlerFunc) *Context {
-	rw := &responseWriter{w: w}
-	return &Context{
-		Context:  c,
-		R:        r,
-		W:        rw,
-		Params:   &Params{r: r, p: p},
-		Values:   make(map[interface{}]interface{}),
-		w:        rw,
-		handlers: handlers,
-		events:   make(map[Event][]func(*Context)),
+func (this *Context) OnEvent(event Event, fn func(*Context)) {
+	if this.events == nil {
+		this.events = make(map[Event][]func(*Context))
 	}
+	this.events[event] = append(this.events[event], fn)
 }
 
-// ParseBody parses the body of the request as a JSON string and unmarshals it into dst.
-func (this *Context) ParseBody(dst interface{}) error {
-	if b, err := ioutil.ReadAll(this.R.Body); err != nil {
-		return fmt.Errorf("error reading request body: %v", err)
-	} else {
-		if err = json.Unmarshal(b, dst); err != nil {
-			return ErrBadRequest
-		} else {
-			return nil
-		}
+// Defer registers fn to be run after the response has been sent. Deferred functions run in
+// last-in-first-out order and can inspect Err(), ResponseStatus() and Values.
+// A panic in a deferred function is recovered and logged.
+func (this *Context) Defer(fn func(*Context)) {
+	this.deferred = append(this.deferred, fn)
+}
+
+// runDeferred runs the functions registered with Defer() in reverse order.
+func (this *Context) runDeferred() {
+	for i := len(this.deferred) - 1; i >= 0; i-- {
+		func(fn func(*Context)) {
+			defer this.recoverHook("deferred function")
+			fn(this)
+		}(this.deferred[i])
 	}
 }
 
-func (this *Context) OnEvent(event Event, fn func(*Context)) {
-	this.events[event] = append(this.events[event], fn)
+// finish runs the deferred functions of the context, followed by the OnFinish hooks of the router.
+func (this *Context) finish() {
+	this.runDeferred()
+	if this.router == nil {
+		return
+	}
+	for _, fn := range this.router.finishHooks() {
+		func() {
+			defer this.recoverHook("finish hook")
+			fn(this)
+		}()
+	}
+}
+
+// reportError calls the OnError hooks of the router with err.
+func (this *Context) reportError(err error) {
+	if this.router == nil {
+		return
+	}
+	for _, fn := range this.router.errorHooks() {
+		func() {
+			defer this.recoverHook("error hook")
+			fn(this, err)
+		}()
+	}
+}
+
+// recoverHook recovers and logs a panic in a hook run after the response. It must be called by defer.
+func (this *Context) recoverHook(name string) {
+	if v := recover(); v != nil {
+		this.Errorf("panic in %s: %v\n%s", name, v, debug.Stack())
+	}
+}
+
+// RoutePattern returns the path pattern the matched route was registered with (e.g. "/users/:id"),
+// including any sub-router prefixes. Returns an empty string for requests not matching any route.
+func (this *Context) RoutePattern() string {
+	return this.pattern
+}
+
+// ResponseStatus returns the status code of the response, or 0 if no response has been written yet.
+// Middleware can read it after calling Next(), or in an OnResponseCompleted event handler.
+func (this *Context) ResponseStatus() int {
+	return this.w.statusCode()
+}
+
+// ResponseSize returns the number of body bytes written to the response so far.
+func (this *Context) ResponseSize() int64 {
+	return this.w.bytesWritten()
+}
+
+// ClientGone reports whether the client has disconnected before the response was complete. The context is
+// cancelled when the client disconnects, so handlers may also select on Done() to stop working early.
+func (this *Context) ClientGone() bool {
+	return this.R.Context().Err() != nil
+}
+
+// RemainingTime returns the time left until the deadline of the context, e.g. for deciding whether there is time
+// for another call to a backend. It is never negative. Without a deadline (see Router.Timeout), the maximum
+// duration is returned.
+func (this *Context) RemainingTime() time.Duration {
+	deadline, ok := this.Deadline()
+	if !ok {
+		return math.MaxInt64
+	} else if d := time.Until(deadline); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// APIVersion returns the API version of the request's route, as set by a router created with Router.Version.
+// Returns an empty string for unversioned routes.
+func (this *Context) APIVersion() string {
+	return this.Values.GetString(KeyAPIVersion)
+}
+
+// Debugf logs a debug message for the current request.
+func (this *Context) Debugf(format string, args ...interface{}) {
+	this.log().Debugf(format, args...)
+}
+
+// Infof logs an informational message for the current request.
+func (this *Context) Infof(format string, args ...interface{}) {
+	this.log().Infof(format, args...)
+}
+
+// Warningf logs a warning message for the current request.
+func (this *Context) Warningf(format string, args ...interface{}) {
+	this.log().Warningf(format, args...)
+}
+
+// Errorf logs an error message for the current request.
+func (this *Context) Errorf(format string, args ...interface{}) {
+	this.log().Errorf(format, args...)
+}
+
+// log returns the Logger of the context, created by the router's NewLogger on first use.
+func (this *Context) log() Logger {
+	if this.logger == nil {
+		if this.router != nil {
+			if fn := this.router.newLogger(); fn != nil {
+				this.logger = fn(this)
+			}
+		}
+		if this.logger == nil {
+			this.logger = stdLogger{}
+		}
+	}
+	return this.logger
 }
 
 // Err() returns any errors returned by the handlers
@@ -111,10 +253,68 @@ func (this *Context) Err() error {
 	}
 }
 
+// Error() records a non-fatal error on the context without stopping the chain of handlers.
+// The error is visible in Err(), but does not affect the response: if no handler returns an error,
+// the result is sent as usual and the recorded errors are logged.
+func (this *Context) Error(err error) {
+	if err != nil {
+		this.errs = append(this.errs, err)
+	}
+}
+
+// HasErrors() reports whether any errors have been returned by handlers or recorded with Error().
+func (this *Context) HasErrors() bool {
+	return len(this.errs) > 0
+}
+
+// Abort() records err as if returned by the current handler and stops the chain of handlers.
+// The error is sent as the response, even if code running after Next() in earlier handlers sets a Result.
+func (this *Context) Abort(err error) {
+	if err != nil {
+		this.fail(err)
+	}
+	this.Stop()
+}
+
+// AbortWithStatus() aborts the chain of handlers with an Error of the given status code and message.
+//
+// Example:
+//
+//	if expired {
+//		c.AbortWithStatus(http.StatusUnauthorized, "token expired")
+//		return nil
+//	}
+func (this *Context) AbortWithStatus(statusCode int, message string) {
+	this.Abort(NewError(statusCode, message))
+}
+
+// fail() records a fatal error, which is sent as the response.
+func (this *Context) fail(err error) {
+	this.errs = append(this.errs, err)
+	this.fatal = append(this.fatal, err)
+}
+
+// fatalErr() returns the errors returned by handlers, in the same form as Err().
+func (this *Context) fatalErr() error {
+	switch len(this.fatal) {
+	case 0:
+		return nil
+	case 1:
+		return this.fatal[0]
+	default:
+		return this.fatal
+	}
+}
+
 // Next() calls the next handler in the chain of handlers, if any.
 // It can be used by middleware handlers to continue processing other handlers and
 // delay execution of code until after these have finished.
 func (this *Context) Next() {
+	if poolChecks {
+		this.w.mu.Lock()
+		this.w.checkRecycled()
+		this.w.mu.Unlock()
+	}
 	if this.index >= len(this.handlers) {
 		return
 	}
@@ -122,9 +322,9 @@ func (this *Context) Next() {
 	this.index += 1
 
 	if err := handler(this); err != nil {
-		this.errs = append(this.errs, err)
+		this.fail(err)
 		this.Stop()
-	} else if this.w.written {
+	} else if this.w.isWritten() {
 		this.Stop()
 	} else {
 		this.Next()
@@ -146,83 +346,443 @@ func (this *Context) Stop() {
 }
 
 // respond() sends a response based on the error and result set by the handlers.
-// If there are any errors, respond() checks to see if it is an (API) Error or ValidationError and
-// returns a non 500 status code response based on the error's status code and type. If not, a 500
-// status code is returned.
+// If any handler has returned an error, respond() checks to see if it is, or wraps, an (API) Error or
+// ValidationError and returns a non 500 status code response based on the error's status code and type.
+// If not, a 500 status code is returned.
 // If there are no errors, the context's result is JSON encoded and written to the response writer.
 // If any of the handlers have written to the context's ResponseWriter, respond() does nothing.
 func (this *Context) respond() {
-	if this.w.written {
+	if this.w.isWritten() {
 		// if any handler has written to the writer already, return
+		if err := this.fatalErr(); err != nil {
+			this.reportError(err)
+		}
+		return
+	}
+
+	if this.ClientGone() {
+		// nobody is listening for the response
+		this.Debugf("client gone before response to %s %s", this.R.Method, this.R.URL.Path)
 		return
 	}
 
 	w := this.W
 	var statusCode int
 
-	if err := this.Err(); err != nil {
+	if len(this.fatal) == 0 {
+		// errors recorded with Error() don't affect a successful response, so only log them
+		for _, err := range this.errs {
+			this.Warningf("non-fatal error: %v", err)
+		}
+	}
+
+	err := this.fatalErr()
+	enc := this.encoder()
+	callback, jsonp, cerr := this.jsonpCallback()
+	if cerr != nil {
+		// never reflect an invalid callback name
+		err = cerr
+	}
+	if jsonp {
+		enc = defaultEncoders[0]
+	} else if enc == nil {
+		// the client accepts none of the registered content types, so answer in the default format
+		enc = defaultEncoders[0]
+		err = ErrNotAcceptable
+	}
+
+	if err != nil {
 
 		this.Result = nil
 
-		if verr, ok := err.(*ValidationError); ok {
+		var verr *ValidationError
+		var apierr *Error
+		if errors.As(err, &verr) {
 			statusCode = StatusValidationError
-			s := struct {
-				StatusCode int           `json:"statusCode"`
-				ErrorCode  string        `json:"errorCode"`
-				Message    string        `json:"message"`
-				Errors     []*FieldError `json:"errors"`
-			}{
-				StatusValidationError,
-				"multi",
-				"Validation error. See errors array for details.",
-				verr.Errors,
+			this.Result = &validationErrorResponse{
+				StatusCode: StatusValidationError,
+				ErrorCode:  "multi",
+				Message:    "Validation error. See errors array for details.",
+				Errors:     verr.Errors,
 			}
-			this.Result = &s
-		} else if apierr, ok := err.(*Error); ok {
+		} else if errors.As(err, &apierr) {
 			statusCode = apierr.StatusCode
-			if apierr.Message != "" {
+			if apierr.Message != "" || this.pattern == "" {
+				// requests not matching any route get the status-only payload, e.g. {"statusCode":404},
+				// telling clients the route doesn't exist
 				this.Result = apierr
 			}
 		} else {
 			statusCode = http.StatusInternalServerError
+			var perr *panicError
+			if errors.As(err, &perr) && this.router != nil && this.router.debugEnabled() {
+				this.Result = &panicResponse{
+					StatusCode: statusCode,
+					Message:    "Internal server error",
+					Panic:      fmt.Sprint(perr.value),
+					Stack:      perr.stack,
+				}
+			} else if perr != nil {
+				// never include the details of the panic outside debug mode
+				this.Result = errPanicked
+			}
 		}
 
+	} else if this.status != 0 {
+		statusCode = this.status
+	} else if this.Result == nil && this.router != nil && this.router.emptyResultStatus() != 0 {
+		statusCode = this.router.emptyResultStatus()
 	} else {
 		statusCode = http.StatusOK
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if this.Result != nil {
-		if b, err := json.Marshal(this.Result); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+	if this.router != nil && statusCode != http.StatusNoContent {
+		if fn := this.router.responseTransformer(); fn != nil {
+			var result interface{}
+			if err == nil {
+				result = this.Result
+			}
+			if v := fn(this, result, err); v != nil {
+				this.Result = v
+			}
+		}
+	}
+
+	contentType, marshal := enc.contentType, enc.encode
+	if jsonp {
+		contentType = "application/javascript"
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	if statusCode == http.StatusNoContent {
+		// 204 responses have neither body nor content type
+		w.WriteHeader(statusCode)
+	} else if err == nil && statusCode == http.StatusOK && (this.etag != "" || !this.lastModified.IsZero()) && this.notModified(this.etag) {
+		w.WriteHeader(http.StatusNotModified)
+	} else if stream := enc.streamer(); stream != nil && this.Result != nil && !this.pretty() && !this.computesETag(statusCode) && !jsonp {
+		w.Header().Set("Content-Type", contentType)
+		if this.R.Method == "HEAD" {
+			// responses to HEAD requests have the headers of the GET response, but no body
+			cw := &countingWriter{}
+			if err := stream(cw, this.Result); err != nil {
+				this.encodingFailed(err)
+			} else {
+				w.Header().Set("Content-Length", strconv.FormatInt(cw.n, 10))
+				w.WriteHeader(statusCode)
+			}
 		} else {
-			w.WriteHeader(statusCode)
-			w.Write(b)
+			// encode straight to the response, deferring the status code until the encoding has started,
+			// so failures to encode the result are still answered with a 500
+			sw := &statusWriter{w: w, status: statusCode}
+			if err := stream(sw, this.Result); err != nil {
+				if sw.wroteHeader {
+					// too late to change the response
+					this.Errorf("error encoding response: %v", err)
+				} else {
+					this.encodingFailed(err)
+				}
+			}
+		}
+	} else if this.Result != nil {
+		w.Header().Set("Content-Type", contentType)
+		b, merr := marshal(this.Result)
+		if merr != nil && enc != defaultEncoders[0] {
+			// the encoder can't encode the result, e.g. a map for encoding/xml or an error payload for a protobuf
+			// encoder, so fall back to JSON
+			if merr != ErrUnsupportedType {
+				this.Warningf("error encoding response as %s, falling back to JSON: %v", enc.contentType, merr)
+			}
+			enc = defaultEncoders[0]
+			w.Header().Set("Content-Type", enc.contentType)
+			b, merr = enc.encode(this.Result)
+		}
+		if merr != nil {
+			this.encodingFailed(merr)
+		} else {
+			if enc.contentType == "application/json" {
+				b = this.indent(b)
+			}
+			if jsonp {
+				b = wrapJSONP(callback, b)
+			}
+			if err == nil && this.computesETag(statusCode) && this.notModified(bodyETag(b)) {
+				w.Header().Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+			} else if this.R.Method == "HEAD" {
+				// responses to HEAD requests have the headers of the GET response, but no body
+				w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+				w.WriteHeader(statusCode)
+			} else {
+				w.WriteHeader(statusCode)
+				w.Write(b)
+			}
 		}
 	} else {
+		w.Header().Set("Content-Type", contentType)
 		w.WriteHeader(statusCode)
 	}
+	if err != nil {
+		this.reportError(err)
+	}
 	for _, fn := range this.events[OnResponseCompleted] {
 		fn(this)
 	}
 }
 
-// responseWriter wraps a http.ResponseWriter and tracks whether or not Write() or WriteHeader() has been called
+// errPanicked is sent when a handler panics, outside debug mode.
+var errPanicked = NewError(http.StatusInternalServerError, "Internal server error")
+
+// errEncodingFailed is sent when the Result can't be encoded. It never includes the encoding error.
+var errEncodingFailed = NewError(http.StatusInternalServerError, "response serialization failed")
+
+// encodingFailed logs err from encoding the response, sends a 500 JSON response instead and reports err
+// to the OnError hooks.
+func (this *Context) encodingFailed(err error) {
+	this.Errorf("error encoding response: %v", err)
+	h := this.W.Header()
+	h.Set("Content-Type", "application/json")
+	h.Del("ETag")
+	h.Del("Last-Modified")
+	b, merr := Marshal(errEncodingFailed)
+	if merr != nil {
+		b = []byte(`{"statusCode":500,"message":"response serialization failed"}`)
+	}
+	if this.R.Method == "HEAD" {
+		h.Set("Content-Length", strconv.Itoa(len(b)))
+		this.W.WriteHeader(http.StatusInternalServerError)
+	} else {
+		this.W.WriteHeader(http.StatusInternalServerError)
+		this.W.Write(b)
+	}
+	this.reportError(err)
+}
+
+// statusWriter writes a status code to the wrapped writer before the first write.
+type statusWriter struct {
+	w           http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (this *statusWriter) Write(b []byte) (int, error) {
+	if !this.wroteHeader {
+		this.w.WriteHeader(this.status)
+		this.wroteHeader = true
+	}
+	return this.w.Write(b)
+}
+
+// countingWriter discards everything written to it, counting the bytes.
+type countingWriter struct {
+	n int64
+}
+
+func (this *countingWriter) Write(b []byte) (int, error) {
+	this.n += int64(len(b))
+	return len(b), nil
+}
+
+// responseWriter wraps a http.ResponseWriter and tracks whether or not Write() or WriteHeader() has been called,
+// along with the status code and size of the response.
+// It is safe for concurrent use. Once the deadline context is done, it sends a 503 response and discards all writes.
+// While a deadline applies, handlers get a private header map, copied to the underlying writer when the response
+// is written, as the timeout response must not share the header map with handlers that may still be running.
 type responseWriter struct {
-	w       http.ResponseWriter
-	written bool
+	w        http.ResponseWriter
+	h        http.Header // h is the handlers' header map while a deadline applies, or nil
+	mu       sync.Mutex
+	written  bool
+	status   int             // status is the status code written, or 0 if none has been written
+	size     int64           // size is the number of body bytes written
+	recycled bool            // recycled is set when the context has been released, see Context.release
+	deadline context.Context // deadline is the context limiting the handlers' time when a timeout applies
+	timedOut bool
 }
 
 func (this *responseWriter) Header() http.Header {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.checkRecycled()
+	if this.timedOut {
+		// the response has been sent, so hand out a detached header to late handlers
+		return make(http.Header)
+	}
+	if this.h != nil {
+		return this.h
+	}
 	return this.w.Header()
 }
 
 func (this *responseWriter) Write(b []byte) (int, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.checkRecycled()
+	if this.expired() {
+		return 0, http.ErrHandlerTimeout
+	}
+	this.copyHeaderLocked()
 	this.written = true
-	return this.w.Write(b)
+	if this.status == 0 {
+		this.status = http.StatusOK
+	}
+	n, err := this.w.Write(b)
+	this.size += int64(n)
+	return n, err
 }
 
 func (this *responseWriter) WriteHeader(statusCode int) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.checkRecycled()
+	if this.expired() {
+		return
+	}
+	this.copyHeaderLocked()
 	this.written = true
+	if this.status == 0 {
+		this.status = statusCode
+	}
 	this.w.WriteHeader(statusCode)
 }
+
+// Flush flushes the underlying response writer if it supports flushing.
+func (this *responseWriter) Flush() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.expired() {
+		return
+	}
+	if f, ok := this.w.(http.Flusher); ok {
+		this.copyHeaderLocked()
+		this.written = true
+		if this.status == 0 {
+			this.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the connection of the underlying response writer, marking the response as written.
+// Returns an error if the underlying response writer doesn't support hijacking.
+func (this *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	h, ok := this.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("milk: response writer does not support hijacking")
+	}
+	this.copyHeaderLocked()
+	this.written = true
+	if this.status == 0 {
+		this.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// CloseNotify passes through to the underlying response writer if it implements http.CloseNotifier.
+// Otherwise the returned channel never receives a value; use the request's context instead.
+func (this *responseWriter) CloseNotify() <-chan bool {
+	if cn, ok := this.w.(http.CloseNotifier); ok {
+		return cn.CloseNotify()
+	}
+	return make(chan bool)
+}
+
+// Unwrap returns the underlying response writer, letting http.ResponseController reach its optional methods.
+func (this *responseWriter) Unwrap() http.ResponseWriter {
+	return this.w
+}
+
+func (this *responseWriter) isWritten() bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.written
+}
+
+// statusCode returns the status code of the response, or 0 if nothing has been written.
+func (this *responseWriter) statusCode() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.written && this.status == 0 {
+		// a response marked as written without any explicit status is sent as 200 by net/http
+		return http.StatusOK
+	}
+	return this.status
+}
+
+func (this *responseWriter) bytesWritten() int64 {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.size
+}
+
+func (this *responseWriter) markWritten() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.written = true
+}
+
+// timeout sends a 503 response unless a response has already been written, and discards all later writes.
+func (this *responseWriter) timeout() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.timeoutLocked()
+}
+
+// setDeadline sets the context whose deadline times out the writer, or clears it once the handlers have returned.
+// Until it is cleared, handlers get a private copy of the header map.
+func (this *responseWriter) setDeadline(deadline context.Context) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.deadline = deadline
+	if deadline == nil {
+		this.copyHeaderLocked()
+	} else if !this.written && this.h == nil {
+		this.h = this.w.Header().Clone()
+		if this.h == nil {
+			this.h = make(http.Header)
+		}
+	}
+}
+
+// copyHeaderLocked replaces the header map of the underlying writer with the handlers' private header map, if any,
+// and hands out the underlying map from then on. this.mu must be held.
+func (this *responseWriter) copyHeaderLocked() {
+	if this.h == nil {
+		return
+	}
+	dst := this.w.Header()
+	for key := range dst {
+		if _, ok := this.h[key]; !ok {
+			delete(dst, key)
+		}
+	}
+	for key, values := range this.h {
+		dst[key] = values
+	}
+	this.h = nil
+}
+
+// expired reports whether the deadline has passed, timing out the writer if it has. this.mu must be held.
+func (this *responseWriter) expired() bool {
+	if !this.timedOut && this.deadline != nil && this.deadline.Err() == context.DeadlineExceeded {
+		this.timeoutLocked()
+	}
+	return this.timedOut
+}
+
+// timeoutLocked is timeout with this.mu held.
+func (this *responseWriter) timeoutLocked() {
+	if this.timedOut {
+		return
+	}
+	if !this.written {
+		b, _ := Marshal(ErrTimeout)
+		this.w.Header().Set("Content-Type", "application/json")
+		this.w.WriteHeader(http.StatusServiceUnavailable)
+		n, _ := this.w.Write(b)
+		this.written = true
+		this.status = http.StatusServiceUnavailable
+		this.size += int64(n)
+	}
+	this.timedOut = true
+}
@@ -0,0 +1,419 @@
+package milk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContextError(t *testing.T) {
+	errDB := errors.New("db down")
+	errCache := errors.New("cache miss")
+	tests := []struct {
+		name      string
+		handlers  []HandlerFunc
+		status    int
+		body      string
+		err       string // err is the expected Err() after the handlers have run
+		hasErrors bool
+		warnings  int
+	}{
+		{
+			name:     "no errors",
+			handlers: []HandlerFunc{func(c *Context) error { c.Result = "ok"; return nil }},
+			status:   200, body: `"ok"`,
+		},
+		{
+			name: "non-fatal errors",
+			handlers: []HandlerFunc{func(c *Context) error {
+				c.Error(errDB)
+				c.Error(nil)
+				c.Error(errCache)
+				c.Result = "ok"
+				return nil
+			}},
+			status: 200, body: `"ok"`, err: "Multiple handlers returned error:\nError #1\ndb down\nError #2\ncache miss\n", hasErrors: true, warnings: 2,
+		},
+		{
+			name: "non-fatal error followed by a returned error",
+			handlers: []HandlerFunc{
+				func(c *Context) error { c.Error(errCache); return nil },
+				func(c *Context) error { return ErrConflict },
+			},
+			status: 409, err: "Multiple handlers returned error:\nError #1\ncache miss\nError #2\nAPI Error (409): \n", hasErrors: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			var err error
+			var hasErrors bool
+			r.Use(func(c *Context) error {
+				c.Next()
+				err, hasErrors = c.Err(), c.HasErrors()
+				return nil
+			})
+			r.Get("/x", test.handlers...)
+			w := serveRequest(r, "GET", "/x", nil)
+			if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.body {
+				t.Fatalf("expected %d %s, got %d %s", test.status, test.body, w.Code, w.Body)
+			}
+			if got := ""; err != nil {
+				if got = err.Error(); got != test.err {
+					t.Errorf("expected Err() %q, got %q", test.err, got)
+				}
+			} else if test.err != "" {
+				t.Errorf("expected Err() %q, got nil", test.err)
+			}
+			if hasErrors != test.hasErrors {
+				t.Errorf("expected HasErrors() %v, got %v", test.hasErrors, hasErrors)
+			}
+			var warnings int
+			for _, entry := range logger.Entries() {
+				if entry.Level == "WARNING" && strings.HasPrefix(entry.Message, "non-fatal error") {
+					warnings++
+				}
+			}
+			if warnings != test.warnings {
+				t.Errorf("expected %d logged non-fatal errors, got %v", test.warnings, logger.Entries())
+			}
+		})
+	}
+}
+
+func TestAbort(t *testing.T) {
+	tests := []struct {
+		name     string
+		handlers []HandlerFunc
+		status   int
+		body     string
+		err      string // err is the expected Err() after the handlers have run
+	}{
+		{
+			name: "abort with status",
+			handlers: []HandlerFunc{
+				func(c *Context) error {
+					c.Next()
+					c.Result = "overwritten"
+					return nil
+				},
+				func(c *Context) error { c.AbortWithStatus(401, "token expired"); return nil },
+				func(c *Context) error { panic("never runs") },
+			},
+			status: 401, body: `{"statusCode":401,"message":"token expired"}`, err: "API Error (401): token expired",
+		},
+		{
+			name: "abort with error",
+			handlers: []HandlerFunc{
+				func(c *Context) error { c.Abort(ErrForbidden); return nil },
+				func(c *Context) error { panic("never runs") },
+			},
+			status: 403, err: "API Error (403): ",
+		},
+		{
+			name: "abort without error",
+			handlers: []HandlerFunc{
+				func(c *Context) error { c.Result = "early"; c.Abort(nil); return nil },
+				func(c *Context) error { panic("never runs") },
+			},
+			status: 200, body: `"early"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var err error
+			r.Use(func(c *Context) error {
+				c.Next()
+				err = c.Err()
+				return nil
+			})
+			r.Get("/x", test.handlers...)
+			w := serveRequest(r, "GET", "/x", nil)
+			if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.body {
+				t.Fatalf("expected %d %s, got %d %s", test.status, test.body, w.Code, w.Body)
+			}
+			if got := fmt.Sprint(err); err != nil && got != test.err || err == nil && test.err != "" {
+				t.Errorf("expected Err() %q, got %q", test.err, got)
+			}
+		})
+	}
+}
+
+func TestErrorsUnwrap(t *testing.T) {
+	r, _ := newTestRouter()
+	var err error
+	r.Use(func(c *Context) error {
+		c.Defer(func(c *Context) { err = c.Err() })
+		return nil
+	})
+	r.Get("/x", func(c *Context) error { c.Error(context.Canceled); return ErrNotFound })
+	serveRequest(r, "GET", "/x", nil)
+	var errs Errors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected Errors with 2 errors, got %#v", err)
+	}
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected errors.Is to find both errors in %v", err)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		status  int
+	}{
+		{name: "success", handler: func(c *Context) error { c.Result = "ok"; return nil }, status: 200},
+		{name: "error", handler: func(c *Context) error { return ErrForbidden }, status: 403},
+		{name: "panic", handler: func(c *Context) error { panic("boom") }, status: 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			var calls []string
+			r.Use(func(c *Context) error {
+				c.Defer(func(c *Context) { calls = append(calls, "first "+strconv.Itoa(c.ResponseStatus())) })
+				c.Defer(func(c *Context) { panic("deferred failed") })
+				return nil
+			})
+			r.Get("/x", func(c *Context) error {
+				c.Defer(func(c *Context) { calls = append(calls, "last "+strconv.Itoa(c.ResponseStatus())) })
+				return test.handler(c)
+			})
+			if w := serveRequest(r, "GET", "/x", nil); w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			status := strconv.Itoa(test.status)
+			if got, want := strings.Join(calls, ","), "last "+status+",first "+status; got != want {
+				t.Errorf("expected deferred calls %q, got %q", want, got)
+			}
+			var logged bool
+			for _, entry := range logger.Entries() {
+				logged = logged || entry.Level == "ERROR" && strings.Contains(entry.Message, "panic in deferred function: deferred failed")
+			}
+			if !logged {
+				t.Errorf("expected the panicking deferred function to be logged, got %v", logger.Entries())
+			}
+		})
+	}
+}
+
+func TestResponseStatusAndSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		status  int
+		size    int64
+		events  bool // events is set when the response is sent by the context, firing OnResponseCompleted
+	}{
+		{name: "result", handler: func(c *Context) error { c.Result = "hello"; return nil }, status: 200, size: 8, events: true},
+		{name: "created", handler: func(c *Context) error { c.Created("/x/1", 1); return nil }, status: 201, size: 2, events: true},
+		{name: "api error", handler: func(c *Context) error { return NewError(409, "taken") }, status: 409, size: 37, events: true},
+		{name: "written by the handler", handler: func(c *Context) error { return c.Text(202, "abc") }, status: 202, size: 3},
+		{name: "written without status", handler: func(c *Context) error { c.W.Write([]byte("ab")); return nil }, status: 200, size: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var before, after, completedStatus int
+			var size int64
+			r.Use(func(c *Context) error {
+				before = c.ResponseStatus()
+				c.OnEvent(OnResponseCompleted, func(c *Context) { completedStatus = c.ResponseStatus() })
+				c.Defer(func(c *Context) { after, size = c.ResponseStatus(), c.ResponseSize() })
+				return nil
+			})
+			r.Get("/x", test.handler)
+			w := serveRequest(r, "GET", "/x", nil)
+			if before != 0 {
+				t.Errorf("expected no status before the response, got %d", before)
+			}
+			if after != test.status || size != test.size || int64(w.Body.Len()) != test.size {
+				t.Errorf("expected status %d and size %d, got %d and %d (%q)", test.status, test.size, after, size, w.Body)
+			}
+			if want := map[bool]int{true: test.status}[test.events]; completedStatus != want {
+				t.Errorf("expected OnResponseCompleted to see status %d, got %d", want, completedStatus)
+			}
+		})
+	}
+}
+
+func TestClientGone(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		written bool
+	}{
+		{name: "connected", written: true},
+		{name: "disconnected", cancel: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			var gone bool
+			r.Get("/x", func(c *Context) error {
+				gone = c.ClientGone()
+				c.Result = "ok"
+				return nil
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			if test.cancel {
+				cancel()
+			}
+			defer cancel()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/x", nil).WithContext(ctx))
+			if gone != test.cancel {
+				t.Errorf("expected ClientGone() %v, got %v", test.cancel, gone)
+			}
+			if written := w.Body.Len() > 0; written != test.written {
+				t.Errorf("expected a response to be written: %v, got %q", test.written, w.Body)
+			}
+			var logged bool
+			for _, entry := range logger.Entries() {
+				logged = logged || strings.HasPrefix(entry.Message, "client gone")
+			}
+			if logged != test.cancel {
+				t.Errorf("expected the disconnect to be logged: %v, got %v", test.cancel, logger.Entries())
+			}
+		})
+	}
+}
+
+func TestRemainingTime(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "no deadline", min: math.MaxInt64, max: math.MaxInt64},
+		{name: "deadline", timeout: time.Minute, min: 50 * time.Second, max: time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Timeout = test.timeout
+			var remaining time.Duration
+			r.Get("/x", func(c *Context) error { remaining = c.RemainingTime(); return nil })
+			serveRequest(r, "GET", "/x", nil)
+			if remaining < test.min || remaining > test.max {
+				t.Errorf("expected a remaining time between %v and %v, got %v", test.min, test.max, remaining)
+			}
+		})
+	}
+}
+
+func TestValidationErrorResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    func() error
+		status int
+		body   string
+	}{
+		{
+			name: "field errors",
+			err: func() error {
+				verr := NewValidationError()
+				verr.AddError("name", ErrCodeRequired)
+				verr.AddErrorDetailed("age", ErrCodeValueTooLow, 18, "must be at least %d", 18)
+				return verr
+			},
+			status: 422,
+			body: `{"statusCode":422,"errorCode":"multi","message":"Validation error. See errors array for details.","errors":[` +
+				`{"key":"name","errorCode":"required"},{"key":"age","errorCode":"value-too-low","message":"must be at least 18","data":18}]}`,
+		},
+		{
+			name: "wrapped",
+			err: func() error {
+				verr := NewValidationError()
+				verr.AddError("email", ErrCodeDuplicate)
+				return errors.Join(errors.New("create user"), verr)
+			},
+			status: 422,
+			body: `{"statusCode":422,"errorCode":"multi","message":"Validation error. See errors array for details.","errors":[` +
+				`{"key":"email","errorCode":"duplicate"}]}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Get("/x", func(c *Context) error { return test.err() })
+			w := serveRequest(r, "GET", "/x", nil)
+			if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.body {
+				t.Errorf("expected %d %s, got %d %s", test.status, test.body, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestContextLogging(t *testing.T) {
+	tests := []struct {
+		name  string
+		log   func(c *Context)
+		entry LogEntry
+	}{
+		{name: "debug", log: func(c *Context) { c.Debugf("d %d", 1) }, entry: LogEntry{"DEBUG", "d 1"}},
+		{name: "info", log: func(c *Context) { c.Infof("i %s", "x") }, entry: LogEntry{"INFO", "i x"}},
+		{name: "warning", log: func(c *Context) { c.Warningf("w") }, entry: LogEntry{"WARNING", "w"}},
+		{name: "error", log: func(c *Context) { c.Errorf("e %v", errors.New("x")) }, entry: LogEntry{"ERROR", "e x"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			r.Get("/x", func(c *Context) error { test.log(c); return nil })
+			serveRequest(r, "GET", "/x", nil)
+			if entries := logger.Entries(); len(entries) != 1 || entries[0] != test.entry {
+				t.Errorf("expected %v, got %v", test.entry, entries)
+			}
+		})
+	}
+
+	t.Run("without router", func(t *testing.T) {
+		// contexts not created by a router log to the standard logger
+		c := &Context{}
+		if _, ok := c.log().(stdLogger); !ok {
+			t.Errorf("expected the standard logger, got %T", c.log())
+		}
+	})
+}
+
+// BenchmarkLargeResult compares the allocations of encoding a result of about 10MB straight to the response
+// with encoding it into a buffer first, as done for pretty printed responses.
+func BenchmarkLargeResult(b *testing.B) {
+	result := make([]string, 1<<20)
+	for i := range result {
+		result[i] = "abcdefgh"
+	}
+	tests := []struct {
+		name  string
+		setup func(r *Router)
+	}{
+		{name: "streamed", setup: func(r *Router) {}},
+		// pretty printing needs the whole response, but responses larger than PrettyJSONMaxSize are sent compact
+		{name: "buffered", setup: func(r *Router) { r.PrettyJSON, r.PrettyJSONMaxSize = true, 1 }},
+	}
+	for _, test := range tests {
+		b.Run(test.name, func(b *testing.B) {
+			r := NewRouter()
+			test.setup(r)
+			r.Get("/x", func(c *Context) error { c.Result = result; return nil })
+			req := httptest.NewRequest("GET", "/x", nil)
+			w := &countingResponseWriter{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.header, w.n = nil, 0
+				r.ServeHTTP(w, req)
+			}
+			b.SetBytes(w.n)
+		})
+	}
+}
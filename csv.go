@@ -0,0 +1,129 @@
+package milk
+
+import (
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// CSV immediately writes rows as CSV with the given status code, bypassing Result. Fields are quoted
+// as required by RFC 4180 and separated by the router's CSVDelimiter. If filename is not empty,
+// the response is sent as a file download with that name.
+// Rows are written as they are encoded rather than buffered.
+func (this *Context) CSV(status int, filename string, rows [][]string) error {
+	cw := this.csvWriter(status, filename)
+	for _, row := range rows {
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVStructs is like CSV, but writes a slice of structs (or pointers to structs) as CSV, with a header row
+// naming the columns. Each exported field is a column named by its csv tag, or by the field name if it has
+// no tag. Fields tagged with csv:"-" are skipped. Times are formatted as RFC 3339, and other values with
+// fmt.Sprint. Returns an error without writing anything if v is not a slice of structs.
+func (this *Context) CSVStructs(status int, filename string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("milk: CSVStructs requires a slice of structs, got %T", v)
+	}
+	t := rv.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("milk: CSVStructs requires a slice of structs, got %T", v)
+	}
+
+	var fields []int
+	var header []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := f.Tag.Get("csv")
+		if f.PkgPath != "" || name == "-" {
+			continue
+		} else if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, i)
+		header = append(header, name)
+	}
+
+	cw := this.csvWriter(status, filename)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	row := make([]string, len(fields))
+	for i := 0; i < rv.Len(); i++ {
+		elem := reflect.Indirect(rv.Index(i))
+		for j, field := range fields {
+			if elem.IsValid() {
+				row[j] = csvValue(elem.Field(field))
+			} else {
+				// nil pointer elements are written as empty rows
+				row[j] = ""
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvWriter writes the headers of a CSV response and returns a writer for its rows.
+func (this *Context) csvWriter(status int, filename string) *csv.Writer {
+	h := this.W.Header()
+	h.Set("Content-Type", "text/csv; charset=utf-8")
+	if filename != "" {
+		h.Set("Content-Disposition", contentDisposition(filename))
+	}
+	this.W.WriteHeader(status)
+	cw := csv.NewWriter(this.W)
+	if this.router != nil {
+		cw.Comma = this.router.csvDelimiter()
+	}
+	return cw
+}
+
+// csvValue formats a struct field for a CSV response.
+func csvValue(v reflect.Value) string {
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return ""
+		}
+		return csvValue(v.Elem())
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+func (this *Router) csvDelimiter() rune {
+	if this.CSVDelimiter != 0 {
+		return this.CSVDelimiter
+	} else if this.parent != nil {
+		return this.parent.csvDelimiter()
+	} else {
+		return ','
+	}
+}
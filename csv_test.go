@@ -0,0 +1,115 @@
+package milk
+
+import (
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type csvRow struct {
+	Name     string    `csv:"name"`
+	Quote    string    `csv:"quote"`
+	Count    int       `csv:"count"`
+	Price    float64   `csv:"price"`
+	Paid     bool      `csv:"paid"`
+	Due      time.Time `csv:"due"`
+	Note     *string   `csv:"note"`
+	Internal string    `csv:"-"`
+	Untagged uint
+	hidden   string
+}
+
+func TestCSVStructs(t *testing.T) {
+	note := "n"
+	due := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	rows := []*csvRow{
+		{Name: "a", Quote: `say "hi", then leave`, Count: 1, Price: 1.5, Paid: true, Due: due, Note: &note, Internal: "x", Untagged: 7},
+		{Name: "multi\nline", Quote: "semi;colon"},
+		nil,
+	}
+	header := []string{"name", "quote", "count", "price", "paid", "due", "note", "Untagged"}
+	want := [][]string{
+		header,
+		{"a", `say "hi", then leave`, "1", "1.5", "true", "2021-06-01T12:00:00Z", "n", "7"},
+		{"multi\nline", "semi;colon", "0", "0", "false", "0001-01-01T00:00:00Z", "", "0"},
+		{"", "", "", "", "", "", "", ""},
+	}
+	tests := []struct {
+		name      string
+		delimiter rune
+		filename  string
+	}{
+		{name: "comma"},
+		{name: "semicolon", delimiter: ';', filename: "report.csv"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.CSVDelimiter = test.delimiter
+			sub := r.SubRouter("/sub")
+			sub.Get("/x", func(c *Context) error { return c.CSVStructs(200, test.filename, rows) })
+			w := serveRequest(r, "GET", "/sub/x", nil)
+			if w.Code != 200 || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+				t.Fatalf("expected a 200 CSV response, got %d %q", w.Code, w.Header().Get("Content-Type"))
+			}
+			if got := w.Header().Get("Content-Disposition"); (got != "") != (test.filename != "") {
+				t.Errorf("expected a Content-Disposition header only with a filename, got %q", got)
+			}
+			cr := csv.NewReader(strings.NewReader(w.Body.String()))
+			if test.delimiter != 0 {
+				cr.Comma = test.delimiter
+			}
+			got, err := cr.ReadAll()
+			if err != nil {
+				t.Fatalf("error reading the CSV response %q: %v", w.Body, err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("expected %d rows, got %q", len(want), got)
+			}
+			for i := range want {
+				if strings.Join(got[i], "|") != strings.Join(want[i], "|") {
+					t.Errorf("row %d: expected %q, got %q", i, want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCSV(t *testing.T) {
+	tests := []struct {
+		name   string
+		write  func(c *Context) error
+		status int
+		body   string
+	}{
+		{
+			name:   "rows",
+			write:  func(c *Context) error { return c.CSV(200, "", [][]string{{"a", "b,c"}, {`"q"`, ""}}) },
+			status: 200, body: "a,\"b,c\"\n\"\"\"q\"\"\",\n",
+		},
+		{
+			name:   "not a slice",
+			write:  func(c *Context) error { return c.CSVStructs(200, "", csvRow{}) },
+			status: 500,
+		},
+		{
+			name:   "not a slice of structs",
+			write:  func(c *Context) error { return c.CSVStructs(200, "", []string{"a"}) },
+			status: 500,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Get("/x", test.write)
+			w := serveRequest(r, "GET", "/x", nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if test.status == 200 && w.Body.String() != test.body {
+				t.Errorf("expected %q, got %q", test.body, w.Body)
+			}
+		})
+	}
+}
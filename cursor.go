@@ -0,0 +1,122 @@
+package milk
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCursorKey is the CursorKey of root routers not setting one, and the key used by EncodeCursor.
+var DefaultCursorKey []byte
+
+// DefaultCursorTTL is the CursorTTL of root routers not setting one, and the TTL used by EncodeCursor.
+// It is zero, meaning cursors don't expire, by default.
+var DefaultCursorTTL time.Duration
+
+// Cursor holds the fields of an opaque pagination cursor, as passed to EncodeCursor.
+// Numbers are decoded as json.Number; use GetInt64 or GetFloat64 to read them.
+type Cursor map[string]interface{}
+
+// cursorPayload is the signed content of a cursor token.
+type cursorPayload struct {
+	Fields  map[string]interface{} `json:"f"`
+	Expires int64                  `json:"e,omitempty"`
+}
+
+// EncodeCursor returns an opaque cursor token holding the fields, signed with DefaultCursorKey so clients can't
+// tamper with it, and expiring after DefaultCursorTTL. Use Context.EncodeCursor to use the router's CursorKey.
+// Panics if DefaultCursorKey isn't set.
+func EncodeCursor(fields map[string]interface{}) string {
+	return encodeCursor(DefaultCursorKey, DefaultCursorTTL, fields)
+}
+
+// EncodeCursor returns an opaque cursor token holding the fields, signed with the router's CursorKey and expiring
+// after its CursorTTL, for reading with Params.Cursor in a later request. Panics if no CursorKey is set.
+func (this *Context) EncodeCursor(fields map[string]interface{}) string {
+	return encodeCursor(this.router.cursorKey(), this.router.cursorTTL(), fields)
+}
+
+func encodeCursor(key []byte, ttl time.Duration, fields map[string]interface{}) string {
+	if len(key) == 0 {
+		panic("milk: no cursor key set")
+	}
+	payload := cursorPayload{Fields: fields}
+	if ttl > 0 {
+		payload.Expires = time.Now().Add(ttl).Unix()
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		panic("milk: cursor fields can't be encoded: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(cursorMAC(key, b))
+}
+
+// Cursor returns the fields of the cursor token in the given key's value, as encoded by Context.EncodeCursor.
+// Returns a nil Cursor for missing values, i.e. for the first page. Tokens that have been tampered with or
+// weren't signed with the router's CursorKey result in ErrCursorInvalid, and expired tokens in ErrCursorExpired.
+func (this *Params) Cursor(key string) (Cursor, error) {
+	token := this.Get(key)
+	if token == "" {
+		return nil, nil
+	}
+	cursorKey := DefaultCursorKey
+	if this.router != nil {
+		cursorKey = this.router.cursorKey()
+	}
+	i := strings.IndexByte(token, '.')
+	if i < 0 || len(cursorKey) == 0 {
+		return nil, ErrCursorInvalid
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return nil, ErrCursorInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(mac, cursorMAC(cursorKey, b)) {
+		return nil, ErrCursorInvalid
+	}
+	var payload cursorPayload
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
+		return nil, ErrCursorInvalid
+	}
+	if payload.Expires != 0 && time.Now().Unix() > payload.Expires {
+		return nil, ErrCursorExpired
+	}
+	if payload.Fields == nil {
+		return Cursor{}, nil
+	}
+	return Cursor(payload.Fields), nil
+}
+
+func cursorMAC(key, b []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(b)
+	return mac.Sum(nil)
+}
+
+// GetString returns the given field as a string. Returns an empty string for missing fields and fields of other types.
+func (this Cursor) GetString(key string) string {
+	val, _ := this[key].(string)
+	return val
+}
+
+// GetInt64 returns the given field as an int64. Returns 0 for missing fields and fields of other types.
+func (this Cursor) GetInt64(key string) int64 {
+	val, _ := this[key].(json.Number)
+	i, _ := strconv.ParseInt(string(val), 10, 64)
+	return i
+}
+
+// GetFloat64 returns the given field as a float64. Returns 0 for missing fields and fields of other types.
+func (this Cursor) GetFloat64(key string) float64 {
+	val, _ := this[key].(json.Number)
+	f, _ := strconv.ParseFloat(string(val), 64)
+	return f
+}
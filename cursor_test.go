@@ -0,0 +1,96 @@
+package milk
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	fields := map[string]interface{}{"id": 9007199254740993, "name": "a", "score": 1.5}
+	tests := []struct {
+		name   string
+		setup  func(r *Router)
+		token  func(c *Context) string
+		cursor bool // cursor is set when the cursor is expected to be read
+		err    error
+	}{
+		{
+			name:   "round trip",
+			setup:  func(r *Router) { r.CursorKey = []byte("secret") },
+			token:  func(c *Context) string { return c.EncodeCursor(fields) },
+			cursor: true,
+		},
+		{
+			name:   "inherited key and ttl",
+			setup:  func(r *Router) { r.CursorKey, r.CursorTTL = []byte("secret"), time.Hour },
+			token:  func(c *Context) string { return c.EncodeCursor(fields) },
+			cursor: true,
+		},
+		{
+			name:  "missing",
+			setup: func(r *Router) { r.CursorKey = []byte("secret") },
+			token: func(c *Context) string { return "" },
+		},
+		{
+			name:  "tampered",
+			setup: func(r *Router) { r.CursorKey = []byte("secret") },
+			token: func(c *Context) string {
+				token := c.EncodeCursor(fields)
+				other := c.EncodeCursor(map[string]interface{}{"id": 1})
+				return other[:strings.IndexByte(other, '.')] + token[strings.IndexByte(token, '.'):]
+			},
+			err: ErrCursorInvalid,
+		},
+		{
+			name:  "other key",
+			setup: func(r *Router) { r.CursorKey = []byte("secret") },
+			token: func(c *Context) string { return encodeCursor([]byte("other"), 0, fields) },
+			err:   ErrCursorInvalid,
+		},
+		{
+			name:  "garbage",
+			setup: func(r *Router) { r.CursorKey = []byte("secret") },
+			token: func(c *Context) string { return "not a cursor" },
+			err:   ErrCursorInvalid,
+		},
+		{
+			name:  "expired",
+			setup: func(r *Router) { r.CursorKey = []byte("secret") },
+			token: func(c *Context) string {
+				b, _ := json.Marshal(cursorPayload{Fields: fields, Expires: time.Now().Add(-time.Minute).Unix()})
+				return base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(cursorMAC([]byte("secret"), b))
+			},
+			err: ErrCursorExpired,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			test.setup(r)
+			sub := r.SubRouter("/sub")
+			var token string
+			sub.Get("/token", func(c *Context) error { token = test.token(c); return nil })
+			var cursor Cursor
+			var err error
+			sub.Get("/list", func(c *Context) error { cursor, err = c.Params.Cursor("cursor"); return err })
+			serveRequest(r, "GET", "/sub/token", nil)
+			w := serveRequest(r, "GET", "/sub/list?cursor="+url.QueryEscape(token), nil)
+			if err != test.err {
+				t.Fatalf("expected error %v, got %v", test.err, err)
+			}
+			if test.err != nil && w.Code != 400 {
+				t.Errorf("expected status 400, got %d", w.Code)
+			}
+			if (cursor != nil) != test.cursor {
+				t.Fatalf("expected a cursor: %v, got %v", test.cursor, cursor)
+			}
+			if test.cursor && (cursor.GetInt64("id") != 9007199254740993 || cursor.GetString("name") != "a" || cursor.GetFloat64("score") != 1.5) {
+				t.Errorf("expected the fields to round trip, got %v", cursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,12 @@
+// Package milk is a small JSON API framework, by default routing requests with httprouter.
+//
+// All types live in the single milk package: Router registers routes and middleware,
+// Context carries the request, response and parameters through the chain of HandlerFuncs,
+// and Error/ValidationError are serialized to JSON by the context when a handler returns them.
+//
+// Responses are encoded as JSON, or as XML for routers enabling Router.XML, as negotiated from the Accept
+// header. Other encodings, like MessagePack or Protocol Buffers, are plugged in with Router.RegisterEncoder,
+// Router.RegisterDecoder and Router.RegisterCodec, keeping the package free of dependencies on encoding libraries.
+// The separate modules github.com/snechholt/milk/protobuf and github.com/snechholt/milk/msgpack register
+// Protocol Buffers and MessagePack.
+package milk
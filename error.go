@@ -1,6 +1,8 @@
 package milk
 
 import (
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -23,11 +25,21 @@ var (
 	ErrNotFound     = NewError(http.StatusNotFound, "")
 	ErrConflict     = NewError(http.StatusConflict, "")
 	ErrBadRequest   = NewError(http.StatusBadRequest, "")
+
+	ErrRequestEntityTooLarge = NewError(http.StatusRequestEntityTooLarge, "Request body too large")
+	ErrUnsupportedMediaType  = NewError(http.StatusUnsupportedMediaType, "Unsupported content type")
+	ErrNotAcceptable         = NewError(http.StatusNotAcceptable, "None of the accepted content types are supported")
+	ErrTimeout               = NewError(http.StatusServiceUnavailable, "Request timed out")
+
+	ErrCursorInvalid = &Error{StatusCode: http.StatusBadRequest, ErrorCode: "invalid-cursor", Message: "Invalid cursor"}
+	ErrCursorExpired = &Error{StatusCode: http.StatusBadRequest, ErrorCode: "expired-cursor", Message: "Cursor expired"}
 )
 
 type Error struct {
-	StatusCode int    `json:"statusCode"`
-	Message    string `json:"message,omitempty"`
+	XMLName    xml.Name `json:"-" xml:"error"`
+	StatusCode int      `json:"statusCode" xml:"statusCode"`
+	ErrorCode  string   `json:"errorCode,omitempty" xml:"errorCode,omitempty"` // Optional code telling errors with the same status apart
+	Message    string   `json:"message,omitempty" xml:"message,omitempty"`
 }
 
 func NewError(statusCode int, message string) *Error {
@@ -37,6 +49,19 @@ func NewError(statusCode int, message string) *Error {
 	}
 }
 
+// IsStatus reports whether err is, or wraps, an Error with the given status code, or a ValidationError
+// if code is StatusValidationError.
+func IsStatus(err error, code int) bool {
+	var apierr *Error
+	var verr *ValidationError
+	if errors.As(err, &apierr) {
+		return apierr.StatusCode == code
+	} else if errors.As(err, &verr) {
+		return code == StatusValidationError
+	}
+	return false
+}
+
 func (this *Error) Error() string {
 	return fmt.Sprintf("API Error (%d): %s", this.StatusCode, this.Message)
 }
@@ -69,8 +94,33 @@ func (this *ValidationError) HasErrors() bool {
 }
 
 type FieldError struct {
-	FieldName string      `json:"key"`
-	ErrorCode string      `json:"errorCode"`
-	Message   string      `json:"message,omitempty"`
-	Data      interface{} `json:"data,omitempty"`
+	FieldName string      `json:"key" xml:"key"`
+	ErrorCode string      `json:"errorCode" xml:"errorCode"`
+	Message   string      `json:"message,omitempty" xml:"message,omitempty"`
+	Data      interface{} `json:"data,omitempty" xml:"data,omitempty"`
+}
+
+// validationErrorResponse is the response payload sent for a ValidationError.
+type validationErrorResponse struct {
+	XMLName    xml.Name      `json:"-" xml:"error"`
+	StatusCode int           `json:"statusCode" xml:"statusCode"`
+	ErrorCode  string        `json:"errorCode" xml:"errorCode"`
+	Message    string        `json:"message" xml:"message"`
+	Errors     []*FieldError `json:"errors" xml:"errors>error"`
+}
+
+// ErrorPayload returns the status code, error code and message of v, and its field errors, if v is one of the
+// payloads sent for failed requests, e.g. for encoders giving error payloads their own representation.
+// The panic and stack trace of payloads sent in debug mode aren't included.
+func ErrorPayload(v interface{}) (payload *Error, fieldErrors []*FieldError, ok bool) {
+	switch v := v.(type) {
+	case *Error:
+		return v, nil, true
+	case *validationErrorResponse:
+		return &Error{StatusCode: v.StatusCode, ErrorCode: v.ErrorCode, Message: v.Message}, v.Errors, true
+	case *panicResponse:
+		return &Error{StatusCode: v.StatusCode, Message: v.Message}, nil, true
+	default:
+		return nil, nil, false
+	}
 }
@@ -0,0 +1,122 @@
+package milk
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestIsStatus(t *testing.T) {
+	verr := NewValidationError()
+	verr.AddError("name", ErrCodeRequired)
+	tests := []struct {
+		name string
+		err  error
+		code int
+		want bool
+	}{
+		{name: "error", err: ErrNotFound, code: 404, want: true},
+		{name: "other status", err: ErrNotFound, code: 409},
+		{name: "wrapped twice", err: fmt.Errorf("load: %w", fmt.Errorf("query: %w", ErrNotFound)), code: 404, want: true},
+		{name: "joined", err: errors.Join(errors.New("x"), ErrConflict), code: 409, want: true},
+		{name: "validation error", err: fmt.Errorf("save: %w", verr), code: StatusValidationError, want: true},
+		{name: "validation error with other status", err: verr, code: 400},
+		{name: "plain error", err: errors.New("x"), code: 500},
+		{name: "nil", err: nil, code: 404},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := IsStatus(test.err, test.code); got != test.want {
+				t.Errorf("IsStatus(%v, %d): expected %v, got %v", test.err, test.code, test.want, got)
+			}
+		})
+	}
+}
+
+func TestWrappedErrorResponses(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+	}{
+		{name: "wrapped twice", err: fmt.Errorf("load: %w", fmt.Errorf("query: %w", ErrNotFound)), status: 404},
+		{name: "wrapped with message", err: fmt.Errorf("load: %w", NewError(409, "taken")), status: 409, body: `{"statusCode":409,"message":"taken"}`},
+		{name: "wrapped cursor error", err: fmt.Errorf("list: %w", ErrCursorExpired), status: 400, body: `{"statusCode":400,"errorCode":"expired-cursor","message":"Cursor expired"}`},
+		{name: "plain error", err: errors.New("db down"), status: 500},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Get("/x", func(c *Context) error { return test.err })
+			w := serveRequest(r, "GET", "/x", nil)
+			if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.body {
+				t.Errorf("expected %d %s, got %d %s", test.status, test.body, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	verr := NewValidationError()
+	if verr.HasErrors() {
+		t.Error("expected a new validation error to have no errors")
+	}
+	verr.AddErrorDetailed("age", ErrCodeValueTooHigh, 120, "must be at most %d", 120)
+	if !verr.HasErrors() || verr.Errors[0].Message != "must be at most 120" || verr.Errors[0].Data != 120 {
+		t.Errorf("unexpected field error %+v", verr.Errors[0])
+	}
+	if verr.Error() != "Validation error" {
+		t.Errorf("unexpected message %q", verr.Error())
+	}
+}
+
+func TestErrorPayload(t *testing.T) {
+	verr := NewValidationError()
+	verr.AddError("name", ErrCodeRequired)
+	tests := []struct {
+		name        string
+		handler     HandlerFunc
+		debug       bool
+		ok          bool
+		want        Error
+		fieldErrors int
+	}{
+		{name: "error", handler: func(c *Context) error { return NewError(409, "taken") }, ok: true, want: Error{StatusCode: 409, Message: "taken"}},
+		{
+			name: "validation error", handler: func(c *Context) error { return verr }, ok: true, fieldErrors: 1,
+			want: Error{StatusCode: 422, ErrorCode: "multi", Message: "Validation error. See errors array for details."},
+		},
+		{name: "panic", handler: func(c *Context) error { panic("boom") }, ok: true, want: Error{StatusCode: 500, Message: "Internal server error"}},
+		{name: "panic in debug mode", handler: func(c *Context) error { panic("boom") }, debug: true, ok: true, want: Error{StatusCode: 500, Message: "Internal server error"}},
+		{name: "other result", handler: func(c *Context) error { c.Result = "ok"; return nil }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Debug(test.debug)
+			var payload *Error
+			var fieldErrors []*FieldError
+			var ok bool
+			r.RegisterEncoder("application/x-test", func(v interface{}) ([]byte, error) {
+				payload, fieldErrors, ok = ErrorPayload(v)
+				return nil, ErrUnsupportedType
+			})
+			r.Get("/x", test.handler)
+			serveRequest(r, "GET", "/x", nil, "Accept", "application/x-test")
+			if ok != test.ok {
+				t.Fatalf("expected ok %v, got %v", test.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if payload.StatusCode != test.want.StatusCode || payload.ErrorCode != test.want.ErrorCode || payload.Message != test.want.Message {
+				t.Errorf("expected %+v, got %+v", test.want, *payload)
+			}
+			if len(fieldErrors) != test.fieldErrors {
+				t.Errorf("expected %d field errors, got %d", test.fieldErrors, len(fieldErrors))
+			}
+		})
+	}
+}
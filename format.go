@@ -0,0 +1,376 @@
+package milk
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Format is the encoding of a response.
+type Format int
+
+const (
+	FormatDefault Format = iota // Negotiated from the request's Accept header, defaulting to JSON
+	FormatJSON                  // application/json
+	FormatXML                   // application/xml
+)
+
+// DefaultPrettyJSONMaxSize is the default maximum size in bytes of JSON responses that are pretty printed.
+const DefaultPrettyJSONMaxSize = 1 << 20
+
+// Marshal and Unmarshal encode and decode the JSON of responses and request bodies, including error payloads.
+// They default to encoding/json and may be replaced before serving requests, e.g. by a faster implementation.
+var (
+	Marshal   func(v interface{}) ([]byte, error)    = json.Marshal
+	Unmarshal func(data []byte, v interface{}) error = json.Unmarshal
+)
+
+// NewJSONEncoder and NewJSONDecoder create the streaming counterparts of Marshal and Unmarshal, used to encode
+// results straight to the response and to decode request bodies without buffering them. They default to
+// encoding/json, and should be replaced along with Marshal and Unmarshal. As long as only Marshal (or Unmarshal)
+// is replaced, the default streaming counterpart is not used, so the replacement applies to every response
+// (or request body), at the cost of buffering it.
+//
+// ParseBodyStrict always uses NewJSONDecoder, and relies on the decoder implementing DisallowUnknownFields
+// like *json.Decoder to reject unknown fields. MustParseBody, multipart parts and GetJSON always use Unmarshal.
+var (
+	NewJSONEncoder func(w io.Writer) JSONEncoder = newJSONEncoder
+	NewJSONDecoder func(r io.Reader) JSONDecoder = newJSONDecoder
+)
+
+// JSONEncoder writes JSON values to a stream, e.g. *json.Encoder.
+type JSONEncoder interface {
+	Encode(v interface{}) error
+}
+
+// JSONDecoder reads JSON values from a stream, e.g. *json.Decoder. Decode returns io.EOF at the end of the stream.
+type JSONDecoder interface {
+	Decode(v interface{}) error
+}
+
+func newJSONEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+func newJSONDecoder(r io.Reader) JSONDecoder {
+	return json.NewDecoder(r)
+}
+
+// marshalJSON calls Marshal, so replacing Marshal applies to encoders created before the replacement.
+func marshalJSON(v interface{}) ([]byte, error) {
+	return Marshal(v)
+}
+
+// streamsJSON reports whether JSON responses may be encoded with NewJSONEncoder, which isn't the case
+// when Marshal has been replaced without replacing NewJSONEncoder.
+func streamsJSON() bool {
+	return sameFunc(Marshal, json.Marshal) || !sameFunc(NewJSONEncoder, newJSONEncoder)
+}
+
+// decodesJSON reports whether JSON request bodies may be decoded with NewJSONDecoder, which isn't the case
+// when Unmarshal has been replaced without replacing NewJSONDecoder.
+func decodesJSON() bool {
+	return sameFunc(Unmarshal, json.Unmarshal) || !sameFunc(NewJSONDecoder, newJSONDecoder)
+}
+
+// sameFunc reports whether the funcs f and g are the same function.
+func sameFunc(f, g interface{}) bool {
+	return reflect.ValueOf(f).Pointer() == reflect.ValueOf(g).Pointer()
+}
+
+// ErrUnsupportedType is returned by an Encoder or Decoder for values of types it doesn't support.
+// The response is then encoded as JSON, and request bodies are rejected with ErrUnsupportedMediaType.
+var ErrUnsupportedType = errors.New("milk: type not supported by encoding")
+
+// Encoder marshals the Result and error payloads of responses, e.g. json.Marshal.
+type Encoder func(v interface{}) ([]byte, error)
+
+// Decoder unmarshals request bodies, e.g. json.Unmarshal.
+type Decoder func(data []byte, v interface{}) error
+
+// encoder is an Encoder registered for a content type.
+type encoder struct {
+	contentType string
+	encode      Encoder
+	stream      func(w io.Writer, v interface{}) error // stream encodes directly to the response, if supported
+}
+
+// defaultEncoders are the encoders available on every router, JSON being the default. The XML encoders are only
+// negotiated for routers enabling XML.
+var defaultEncoders = []*encoder{
+	{"application/json", marshalJSON, streamJSON},
+	xmlEncoders[0],
+	xmlEncoders[1],
+}
+
+var xmlEncoders = []*encoder{
+	{"application/xml", xml.Marshal, nil},
+	{"text/xml", xml.Marshal, nil},
+}
+
+// streamJSON encodes v as JSON to w with NewJSONEncoder.
+func streamJSON(w io.Writer, v interface{}) error {
+	return NewJSONEncoder(w).Encode(v)
+}
+
+// streamer returns the func encoding directly to the response, or nil if the response must be marshaled
+// into memory, as is the case for JSON when only Marshal has been replaced (see NewJSONEncoder).
+func (this *encoder) streamer() func(w io.Writer, v interface{}) error {
+	if this.stream == nil || !streamsJSON() {
+		return nil
+	}
+	return this.stream
+}
+
+// RegisterEncoder makes enc encode responses to requests accepting contentType, e.g. "application/msgpack".
+// Encoders registered on a router apply to its sub-routers as well, and replace any encoder registered
+// for the same content type by a parent or by default. JSON remains the format of requests without preference.
+//
+// Encoders returning ErrUnsupportedType for error payloads send them as JSON; see ErrorPayload for giving them
+// a representation of their own. Protocol Buffers are registered by the separate module milk/protobuf.
+func (this *Router) RegisterEncoder(contentType string, enc Encoder) {
+	this.encoders = append(this.encoders, &encoder{contentType: strings.ToLower(contentType), encode: enc})
+}
+
+// RegisterCodec registers enc and dec for contentType, for encodings used for both requests and responses.
+// MessagePack is registered this way by the separate module milk/msgpack.
+func (this *Router) RegisterCodec(contentType string, enc Encoder, dec Decoder) {
+	this.RegisterEncoder(contentType, enc)
+	this.RegisterDecoder(contentType, dec)
+}
+
+// RegisterDecoder makes dec decode the bodies of requests with the given content type for Context.ParseBody,
+// e.g. "application/x-protobuf". Decoders registered on a router apply to its sub-routers as well.
+// Bodies of other content types are decoded as JSON.
+func (this *Router) RegisterDecoder(contentType string, dec Decoder) {
+	if this.decoders == nil {
+		this.decoders = make(map[string]Decoder)
+	}
+	this.decoders[strings.ToLower(contentType)] = dec
+}
+
+func (this *Router) decoder(contentType string) Decoder {
+	if dec, ok := this.decoders[contentType]; ok {
+		return dec
+	} else if this.parent != nil {
+		return this.parent.decoder(contentType)
+	} else {
+		return nil
+	}
+}
+
+// encoderList returns the encoders available to the router's routes in order of registration,
+// starting with the default encoders.
+func (this *Router) encoderList() []*encoder {
+	var list []*encoder
+	if this.parent != nil {
+		list = this.parent.encoderList()
+	} else {
+		list = append(list, defaultEncoders...)
+	}
+outer:
+	for _, enc := range this.encoders {
+		for i, e := range list {
+			if e.contentType == enc.contentType {
+				list[i] = enc
+				continue outer
+			}
+		}
+		list = append(list, enc)
+	}
+	return list
+}
+
+// Negotiated returns the content type the response is encoded in, as negotiated from the request's Accept header.
+// Returns an empty string if the client doesn't accept any of the content types of the registered encoders.
+func (this *Context) Negotiated() string {
+	if enc := this.encoder(); enc != nil {
+		return enc.contentType
+	}
+	return ""
+}
+
+// encoder returns the encoder of the response, or nil if none is acceptable to the client.
+// The context's ResponseFormat takes precedence over the Accept header.
+func (this *Context) encoder() *encoder {
+	if !this.negotiated {
+		this.enc = this.negotiate()
+		this.negotiated = true
+	}
+	return this.enc
+}
+
+// negotiate picks the encoder the client gives the highest quality, preferring the one listed first in the
+// Accept header on ties. Encoders not matched by the Accept header are used only if no encoder is matched,
+// JSON being the first of them. The default XML encoders are skipped unless the router enables XML.
+// Returns nil only if every encoder is excluded by a zero quality.
+func (this *Context) negotiate() *encoder {
+	var list []*encoder
+	if this.router != nil {
+		list = this.router.encoderList()
+	} else {
+		list = defaultEncoders
+	}
+	switch this.ResponseFormat {
+	case FormatJSON:
+		return findEncoder(list, "application/json")
+	case FormatXML:
+		return findEncoder(list, "application/xml")
+	}
+
+	ranges := parseAccept(this.R.Header.Get("Accept"))
+	xmlEnabled := this.router != nil && this.router.xml()
+	var best, fallback *encoder
+	var bestQ float64
+	bestIndex := len(ranges)
+	for _, enc := range list {
+		if !xmlEnabled && (enc == xmlEncoders[0] || enc == xmlEncoders[1]) {
+			continue
+		}
+		q, index := quality(ranges, enc.contentType)
+		if index < 0 {
+			if fallback == nil {
+				fallback = enc
+			}
+		} else if q > bestQ || (q == bestQ && q > 0 && index < bestIndex) {
+			best, bestQ, bestIndex = enc, q, index
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return fallback
+}
+
+// indent returns the JSON response b indented with two spaces if pretty printing is enabled for the request,
+// either by the router's PrettyJSON or the query parameter pretty, and b is within the router's PrettyJSONMaxSize.
+func (this *Context) indent(b []byte) []byte {
+	if !this.pretty() || len(b) > this.router.prettyJSONMaxSize() {
+		return b
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", "  "); err != nil {
+		return b
+	}
+	return buf.Bytes()
+}
+
+// pretty reports whether pretty printing of JSON is enabled for the request.
+func (this *Context) pretty() bool {
+	if this.router == nil {
+		return false
+	}
+	pretty := this.router.prettyJSON()
+	if v, ok := this.Params.query()["pretty"]; ok {
+		p, err := strconv.ParseBool(v[0])
+		pretty = v[0] == "" || (err == nil && p)
+	}
+	return pretty
+}
+
+// ContentType returns the media type of the request's Content-Type header in lower case, without parameters
+// like charset. Returns an empty string if the header is missing.
+func (this *Context) ContentType() string {
+	header := this.R.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(header); err == nil {
+		return mediaType
+	}
+	// fall back to the part before any parameters of malformed headers
+	if i := strings.IndexByte(header, ';'); i >= 0 {
+		header = header[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(header))
+}
+
+// IsJSON reports whether the request's content type is JSON, including structured syntax suffixes like
+// application/problem+json.
+func (this *Context) IsJSON() bool {
+	contentType := this.ContentType()
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+// Accepts returns the type of types the request's Accept header gives the highest quality, preferring the one
+// listed first in the header on ties, e.g. c.Accepts("text/html", "application/json"). Wildcards like "text/*"
+// in the header are matched. Returns the first type if the request has no (valid) Accept header, and an empty
+// string if the header doesn't accept any of the types.
+func (this *Context) Accepts(types ...string) string {
+	if len(types) == 0 {
+		return ""
+	}
+	ranges := parseAccept(this.R.Header.Get("Accept"))
+	if len(ranges) == 0 {
+		return types[0]
+	}
+	best, bestQ, bestIndex := "", 0.0, len(ranges)
+	for _, t := range types {
+		q, index := quality(ranges, strings.ToLower(t))
+		if index >= 0 && (q > bestQ || (q == bestQ && q > 0 && index < bestIndex)) {
+			best, bestQ, bestIndex = t, q, index
+		}
+	}
+	return best
+}
+
+func findEncoder(list []*encoder, contentType string) *encoder {
+	for _, enc := range list {
+		if enc.contentType == contentType {
+			return enc
+		}
+	}
+	return nil
+}
+
+// acceptRange is a media range of an Accept header, e.g. "text/*;q=0.5".
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses the media ranges of an Accept header. Ranges without a valid q-value have quality 1.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, s := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(s))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 && f <= 1 {
+				q = f
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// quality returns the quality given to contentType by the most specific range matching it, and the index
+// of that range. The index is -1 if no range matches.
+func quality(ranges []acceptRange, contentType string) (float64, int) {
+	q, index, specificity := 0.0, -1, -1
+	typ := contentType[:strings.IndexByte(contentType+"/", '/')]
+	for i, r := range ranges {
+		var s int
+		switch r.mediaType {
+		case contentType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, index, specificity = r.q, i, s
+		}
+	}
+	return q, index
+}
@@ -0,0 +1,442 @@
+package milk
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type xmlItem struct {
+	XMLName xml.Name `xml:"item" json:"-"`
+	ID      int      `xml:"id,attr" json:"id"`
+	Name    string   `xml:"name" json:"name"`
+	Tags    []string `xml:"tags>tag" json:"tags"`
+}
+
+func TestXMLNegotiation(t *testing.T) {
+	tests := []struct {
+		name        string
+		xml         bool
+		format      Format
+		accept      string
+		result      interface{}
+		contentType string
+		body        string
+	}{
+		{
+			name:   "xml not enabled",
+			accept: "application/xml", result: xmlItem{ID: 1, Name: "a"},
+			contentType: "application/json", body: `{"id":1,"name":"a","tags":null}`,
+		},
+		{
+			name: "xml enabled", xml: true,
+			accept: "application/xml", result: xmlItem{ID: 1, Name: "a", Tags: []string{"x"}},
+			contentType: "application/xml", body: `<item id="1"><name>a</name><tags><tag>x</tag></tags></item>`,
+		},
+		{
+			name: "text/xml", xml: true,
+			accept: "text/xml", result: xmlItem{ID: 1, Name: "a"},
+			contentType: "text/xml", body: `<item id="1"><name>a</name><tags></tags></item>`,
+		},
+		{
+			name: "map falls back to json", xml: true,
+			accept: "application/xml", result: map[string]int{"a": 1},
+			contentType: "application/json", body: `{"a":1}`,
+		},
+		{
+			name:   "response format",
+			format: FormatXML, result: xmlItem{ID: 2, Name: "b"},
+			contentType: "application/xml", body: `<item id="2"><name>b</name><tags></tags></item>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.XML = test.xml
+			r.Get("/x", func(c *Context) error {
+				c.ResponseFormat = test.format
+				c.Result = test.result
+				return nil
+			})
+			w := serveRequest(r, "GET", "/x", nil, "Accept", test.accept)
+			if w.Code != 200 {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+				t.Errorf("expected content type %s, got %s", test.contentType, ct)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.body {
+				t.Errorf("expected body %s, got %s", test.body, body)
+			}
+		})
+	}
+}
+
+func TestXMLErrorPayloads(t *testing.T) {
+	r, _ := newTestRouter()
+	r.XML = true
+	r.Get("/x", func(c *Context) error {
+		verr := NewValidationError()
+		verr.AddError("name", ErrCodeRequired)
+		return verr
+	})
+	w := serveRequest(r, "GET", "/x", nil, "Accept", "application/xml")
+	if w.Code != StatusValidationError || w.Header().Get("Content-Type") != "application/xml" {
+		t.Fatalf("expected a 422 XML response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if body := w.Body.String(); !strings.Contains(body, "<key>name</key><errorCode>required</errorCode>") {
+		t.Errorf("expected the field error in the XML payload, got %s", body)
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	const browser = "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8"
+	upper := func(v interface{}) ([]byte, error) { return []byte(strings.ToUpper(v.(string))), nil }
+	tests := []struct {
+		name        string
+		xml         bool
+		accept      string
+		status      int
+		contentType string
+	}{
+		{name: "no accept header", accept: "", status: 200, contentType: "application/json"},
+		{name: "browser", accept: browser, status: 200, contentType: "application/json"},
+		{name: "browser with xml enabled", xml: true, accept: browser, status: 200, contentType: "application/xml"},
+		{name: "wildcard", accept: "*/*", status: 200, contentType: "application/json"},
+		{name: "registered encoder", accept: "text/upper", status: 200, contentType: "text/upper"},
+		{name: "q-values", accept: "application/json;q=0.5, text/upper;q=0.8", status: 200, contentType: "text/upper"},
+		{name: "ties go to the first listed", accept: "text/upper, application/json", status: 200, contentType: "text/upper"},
+		{name: "unmatched types fall back to json", accept: "image/png", status: 200, contentType: "application/json"},
+		{name: "specific range beats wildcard", accept: "*/*;q=0.9, application/json;q=0.1", status: 200, contentType: "text/upper"},
+		{name: "everything excluded", accept: "application/json;q=0, text/upper;q=0, */*;q=0", status: 406, contentType: "application/json"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.XML = test.xml
+			r.RegisterEncoder("text/upper", upper)
+			var negotiated string
+			r.Get("/x", func(c *Context) error {
+				negotiated = c.Negotiated()
+				c.Result = "ok"
+				return nil
+			})
+			w := serveRequest(r, "GET", "/x", nil, "Accept", test.accept)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != test.contentType {
+				t.Errorf("expected content type %s, got %s", test.contentType, ct)
+			}
+			if test.status == 200 && negotiated != test.contentType {
+				t.Errorf("expected Negotiated() to return %s, got %s", test.contentType, negotiated)
+			}
+		})
+	}
+}
+
+// wireItem stands in for a generated protobuf message in tests of pluggable encodings.
+type wireItem struct {
+	ID   int
+	Name string
+}
+
+// wireEncode and wireDecode encode wireItems as "id|name", like a binary encoding supporting only its own messages.
+func wireEncode(v interface{}) ([]byte, error) {
+	item, ok := v.(*wireItem)
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+	return []byte(strconv.Itoa(item.ID) + "|" + item.Name), nil
+}
+
+func wireDecode(data []byte, v interface{}) error {
+	item, ok := v.(*wireItem)
+	if !ok {
+		return ErrUnsupportedType
+	}
+	parts := strings.SplitN(string(data), "|", 2)
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) != 2 {
+		return errors.New("malformed wire item")
+	}
+	item.ID, item.Name = id, parts[1]
+	return nil
+}
+
+func TestPluggableDecoders(t *testing.T) {
+	const proto = "application/x-protobuf"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		dst         func() interface{}
+		fail        bool // whether the handler returns an error regardless of the body
+		accept      string
+		status      int
+		respType    string
+		respBody    string
+	}{
+		{
+			name: "round trip", contentType: proto, body: "7|seven", accept: proto,
+			status: 200, respType: proto, respBody: "7|seven",
+		},
+		{
+			name: "content type parameters", contentType: proto + "; charset=binary", body: "7|seven", accept: proto,
+			status: 200, respType: proto, respBody: "7|seven",
+		},
+		{
+			name: "json request, protobuf response", contentType: "application/json", body: `{"ID":7,"Name":"seven"}`, accept: proto,
+			status: 200, respType: proto, respBody: "7|seven",
+		},
+		{
+			name: "protobuf request, json response", contentType: proto, body: "7|seven",
+			status: 200, respType: "application/json", respBody: `{"ID":7,"Name":"seven"}`,
+		},
+		{
+			name: "malformed body", contentType: proto, body: "seven", accept: proto,
+			status: StatusValidationError, respType: "application/json",
+		},
+		{
+			name: "unsupported destination", contentType: proto, body: "7|seven",
+			dst:    func() interface{} { return &map[string]interface{}{} },
+			status: http.StatusUnsupportedMediaType, respType: "application/json",
+		},
+		{
+			name: "error payloads fall back to json", contentType: proto, body: "7|seven", accept: proto, fail: true,
+			status: http.StatusConflict, respType: "application/json", respBody: `{"statusCode":409,"message":"conflict"}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.RegisterEncoder(proto, wireEncode)
+			r.RegisterDecoder(proto, wireDecode)
+			r.Post("/items", func(c *Context) error {
+				var dst interface{} = &wireItem{}
+				if test.dst != nil {
+					dst = test.dst()
+				}
+				if err := c.ParseBody(dst); err != nil {
+					return err
+				} else if test.fail {
+					return NewError(http.StatusConflict, "conflict")
+				}
+				c.Result = dst
+				return nil
+			})
+			w := serveRequest(r, "POST", "/items", strings.NewReader(test.body), "Content-Type", test.contentType, "Accept", test.accept)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != test.respType {
+				t.Errorf("expected content type %s, got %s", test.respType, ct)
+			}
+			if body := strings.TrimSpace(w.Body.String()); test.respBody != "" && body != test.respBody {
+				t.Errorf("expected body %s, got %s", test.respBody, body)
+			}
+		})
+	}
+}
+
+// recordEncode and recordDecode encode hookItems as "name=<name>", standing in for a MessagePack codec.
+func recordEncode(v interface{}) ([]byte, error) {
+	item, ok := v.(*hookItem)
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+	return []byte("name=" + item.Name), nil
+}
+
+func recordDecode(data []byte, v interface{}) error {
+	item, ok := v.(*hookItem)
+	if !ok {
+		return ErrUnsupportedType
+	} else if !strings.HasPrefix(string(data), "name=") {
+		return errors.New("malformed record")
+	}
+	item.Name = strings.TrimPrefix(string(data), "name=")
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	const record = "application/x-record"
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		accept      string
+		respType    string
+		respBody    string
+	}{
+		{name: "codec round trip", contentType: record, body: "name=a", accept: record, respType: record, respBody: "name=a"},
+		{name: "json round trip", contentType: "application/json", body: `{"name":"a"}`, accept: "application/json", respType: "application/json", respBody: `{"name":"a"}`},
+		{name: "codec to json", contentType: record, body: "name=a", respType: "application/json", respBody: `{"name":"a"}`},
+		{name: "json to codec", contentType: "application/json", body: `{"name":"a"}`, accept: record, respType: record, respBody: "name=a"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			// registered on the root router, applying to the sub-router's routes
+			r.RegisterCodec(record, recordEncode, recordDecode)
+			r.SubRouter("/api").Post("/items", func(c *Context) error {
+				var item hookItem
+				if err := c.ParseBody(&item); err != nil {
+					return err
+				}
+				c.Result = &item
+				return nil
+			})
+			w := serveRequest(r, "POST", "/api/items", strings.NewReader(test.body), "Content-Type", test.contentType, "Accept", test.accept)
+			if w.Code != 200 {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if ct := w.Header().Get("Content-Type"); ct != test.respType {
+				t.Errorf("expected content type %s, got %s", test.respType, ct)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.respBody {
+				t.Errorf("expected body %s, got %s", test.respBody, body)
+			}
+		})
+	}
+}
+
+func TestPrettyJSON(t *testing.T) {
+	small := map[string]int{"a": 1}
+	large := strings.Repeat("x", 100)
+	tests := []struct {
+		name    string
+		pretty  bool
+		maxSize int
+		url     string
+		result  interface{}
+		want    string
+	}{
+		{name: "compact", url: "/x", result: small, want: `{"a":1}`},
+		{name: "router setting", pretty: true, url: "/x", result: small, want: "{\n  \"a\": 1\n}"},
+		{name: "query parameter", url: "/x?pretty", result: small, want: "{\n  \"a\": 1\n}"},
+		{name: "query parameter set to true", url: "/x?pretty=1", result: small, want: "{\n  \"a\": 1\n}"},
+		{name: "query parameter disabling", pretty: true, url: "/x?pretty=false", result: small, want: `{"a":1}`},
+		{name: "larger than the limit", pretty: true, maxSize: 50, url: "/x", result: []string{large}, want: `["` + large + `"]`},
+		{name: "within the limit", pretty: true, maxSize: 200, url: "/x", result: []string{large}, want: "[\n  \"" + large + "\"\n]"},
+		{name: "error payload", pretty: true, url: "/error", want: "{\n  \"statusCode\": 409,\n  \"message\": \"taken\"\n}"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.PrettyJSON = test.pretty
+			r.PrettyJSONMaxSize = test.maxSize
+			r.Get("/x", func(c *Context) error { c.Result = test.result; return nil })
+			r.Get("/error", func(c *Context) error { return NewError(409, "taken") })
+			w := serveRequest(r, "GET", test.url, nil)
+			if got := strings.TrimSpace(w.Body.String()); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestResponseTransformer(t *testing.T) {
+	envelope := func(c *Context, result interface{}, err error) interface{} {
+		if err != nil {
+			return map[string]interface{}{"ok": false, "error": err.Error()}
+		}
+		return map[string]interface{}{"ok": true, "data": result}
+	}
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		status  int
+		want    string
+	}{
+		{name: "result", handler: func(c *Context) error { c.Result = []int{1}; return nil }, status: 200, want: `{"data":[1],"ok":true}`},
+		{name: "empty result", handler: func(c *Context) error { return nil }, status: 200, want: `{"data":null,"ok":true}`},
+		{name: "created", handler: func(c *Context) error { c.Created("/x/1", 1); return nil }, status: 201, want: `{"data":1,"ok":true}`},
+		{
+			name: "error", handler: func(c *Context) error { return NewError(409, "taken") },
+			status: 409, want: `{"error":"API Error (409): taken","ok":false}`,
+		},
+		{name: "no content", handler: func(c *Context) error { c.NoContent(); return nil }, status: 204},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.ResponseTransformer = envelope
+			sub := r.SubRouter("/sub")
+			sub.Get("/x", test.handler)
+			w := serveRequest(r, "GET", "/sub/x", nil)
+			if w.Code != test.status || strings.TrimSpace(w.Body.String()) != test.want {
+				t.Errorf("expected %d %s, got %d %s", test.status, test.want, w.Code, w.Body)
+			}
+		})
+	}
+
+	t.Run("nil keeps the response", func(t *testing.T) {
+		r, _ := newTestRouter()
+		r.ResponseTransformer = func(c *Context, result interface{}, err error) interface{} { return nil }
+		r.Get("/x", func(c *Context) error { c.Result = "kept"; return nil })
+		if w := serveRequest(r, "GET", "/x", nil); strings.TrimSpace(w.Body.String()) != `"kept"` {
+			t.Errorf("expected the result to be kept, got %s", w.Body)
+		}
+	})
+}
+
+func TestRequestContentType(t *testing.T) {
+	tests := []struct {
+		header      string
+		contentType string
+		isJSON      bool
+	}{
+		{header: "", contentType: ""},
+		{header: "application/json", contentType: "application/json", isJSON: true},
+		{header: "Application/JSON; charset=UTF-8", contentType: "application/json", isJSON: true},
+		{header: "application/problem+json", contentType: "application/problem+json", isJSON: true},
+		{header: "application/jsonp", contentType: "application/jsonp"},
+		{header: "text/plain; charset", contentType: "text/plain"},
+		{header: "application/x-www-form-urlencoded", contentType: "application/x-www-form-urlencoded"},
+	}
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			c := &Context{R: httptest.NewRequest("POST", "/x", nil)}
+			c.R.Header.Set("Content-Type", test.header)
+			if got := c.ContentType(); got != test.contentType {
+				t.Errorf("expected ContentType() %q, got %q", test.contentType, got)
+			}
+			if got := c.IsJSON(); got != test.isJSON {
+				t.Errorf("expected IsJSON() %v, got %v", test.isJSON, got)
+			}
+		})
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	tests := []struct {
+		accept string
+		types  []string
+		want   string
+	}{
+		{accept: "", types: []string{"text/html", "application/json"}, want: "text/html"},
+		{accept: "application/json", types: []string{"text/html", "application/json"}, want: "application/json"},
+		{accept: "text/html;q=0.5, application/json", types: []string{"text/html", "application/json"}, want: "application/json"},
+		{accept: "text/*", types: []string{"application/json", "text/csv"}, want: "text/csv"},
+		{accept: "*/*", types: []string{"application/json", "text/csv"}, want: "application/json"},
+		{accept: "text/csv, application/json", types: []string{"application/json", "text/csv"}, want: "text/csv"},
+		{accept: "application/json;q=0", types: []string{"application/json"}, want: ""},
+		{accept: "image/png", types: []string{"application/json"}, want: ""},
+		{accept: "APPLICATION/JSON", types: []string{"application/json"}, want: "application/json"},
+		{accept: "application/json", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.accept, func(t *testing.T) {
+			c := &Context{R: httptest.NewRequest("GET", "/x", nil)}
+			c.R.Header.Set("Accept", test.accept)
+			if got := c.Accepts(test.types...); got != test.want {
+				t.Errorf("Accepts(%q): expected %q, got %q", test.types, test.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package milk
+
+import (
+	"regexp"
+)
+
+// callbackPattern matches the JSONP callback names accepted by the router: JavaScript identifiers,
+// optionally namespaced by dots, e.g. "jQuery123.handle"
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][0-9A-Za-z_$]*(\.[A-Za-z_$][0-9A-Za-z_$]*)*$`)
+
+// JSONP makes the route answer requests with a callback query parameter with JSONP, see Router.JSONP.
+func (this *Route) JSONP() *Route {
+	this.jsonp = true
+	return this
+}
+
+func (this *Route) jsonpEnabled() bool {
+	return this.jsonp || this.router.jsonpEnabled()
+}
+
+func (this *Router) jsonpEnabled() bool {
+	return this.JSONP || (this.parent != nil && this.parent.jsonpEnabled())
+}
+
+// jsonpCallback returns the callback of a JSONP request, and false for requests not asking for JSONP or
+// for routes not supporting it. Invalid callback names result in a ValidationError.
+func (this *Context) jsonpCallback() (string, bool, error) {
+	if !this.jsonp {
+		return "", false, nil
+	}
+	values, ok := this.Params.query()["callback"]
+	if !ok {
+		return "", false, nil
+	}
+	if !callbackPattern.MatchString(values[0]) {
+		verr := NewValidationError()
+		verr.AddErrorDetailed("callback", ErrCodeSyntaxError, nil, "Invalid JSONP callback name")
+		return "", false, verr
+	}
+	return values[0], true, nil
+}
+
+// wrapJSONP wraps the JSON response b in a call to callback.
+func wrapJSONP(callback string, b []byte) []byte {
+	out := make([]byte, 0, len(callback)+len(b)+3)
+	out = append(out, callback...)
+	out = append(out, '(')
+	out = append(out, b...)
+	return append(out, ");"...)
+}
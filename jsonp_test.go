@@ -0,0 +1,94 @@
+package milk
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONP(t *testing.T) {
+	tests := []struct {
+		name        string
+		router      bool // router enables JSONP on the router rather than the route
+		url         string
+		handler     HandlerFunc
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			name: "success", url: "/x?callback=handle",
+			handler: func(c *Context) error { c.Result = map[string]int{"a": 1}; return nil },
+			status:  200, contentType: "application/javascript", body: `handle({"a":1});`,
+		},
+		{
+			name: "enabled on the router", router: true, url: "/x?callback=jQuery123.done_",
+			handler: func(c *Context) error { c.Result = 1; return nil },
+			status:  200, contentType: "application/javascript", body: `jQuery123.done_(1);`,
+		},
+		{
+			name: "error", url: "/x?callback=handle",
+			handler: func(c *Context) error { return NewError(409, "taken") },
+			status:  409, contentType: "application/javascript", body: `handle({"statusCode":409,"message":"taken"});`,
+		},
+		{
+			name: "without callback", url: "/x",
+			handler: func(c *Context) error { c.Result = 1; return nil },
+			status:  200, contentType: "application/json", body: "1",
+		},
+		{
+			name: "injection", url: "/x?callback=alert(1)//",
+			handler: func(c *Context) error { c.Result = 1; return nil },
+			status:  422, contentType: "application/json",
+		},
+		{
+			name: "script tag", url: "/x?callback=%3Cscript%3E",
+			handler: func(c *Context) error { c.Result = 1; return nil },
+			status:  422, contentType: "application/json",
+		},
+		{
+			name: "empty callback", url: "/x?callback=",
+			handler: func(c *Context) error { c.Result = 1; return nil },
+			status:  422, contentType: "application/json",
+		},
+		{
+			name: "pretty printed", url: "/x?callback=handle&pretty=1",
+			handler: func(c *Context) error { c.Result = []int{1}; return nil },
+			status:  200, contentType: "application/javascript", body: "handle([\n  1\n]);",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.JSONP = test.router
+			route := r.Get("/x", test.handler)
+			if !test.router {
+				route.JSONP()
+			}
+			w := serveRequest(r, "GET", test.url, nil, "Accept", "application/xml")
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("expected content type %q, got %q", test.contentType, got)
+			}
+			if test.body != "" && strings.TrimSpace(w.Body.String()) != test.body {
+				t.Errorf("expected body %s, got %s", test.body, w.Body)
+			}
+			if test.status == 422 && strings.Contains(w.Body.String(), "alert") {
+				t.Errorf("expected the callback never to be reflected, got %s", w.Body)
+			}
+			if test.contentType == "application/javascript" && w.Header().Get("X-Content-Type-Options") != "nosniff" {
+				t.Error("expected X-Content-Type-Options nosniff")
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		r, _ := newTestRouter()
+		r.Get("/x", func(c *Context) error { c.Result = 1; return nil })
+		w := serveRequest(r, "GET", "/x?callback=handle", nil)
+		if w.Header().Get("Content-Type") != "application/json" || strings.TrimSpace(w.Body.String()) != "1" {
+			t.Errorf("expected a JSON response from routes without JSONP, got %q %s", w.Header().Get("Content-Type"), w.Body)
+		}
+	})
+}
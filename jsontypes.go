@@ -0,0 +1,167 @@
+package milk
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// jsonTypeErrors decodes the JSON document b generically and adds an error with ErrCodeSyntaxError to verr for
+// every value not matching the type t it is decoded into, keyed by the path of the value, e.g. "items[2].price".
+// Types decoding themselves, by implementing json.Unmarshaler or encoding.TextUnmarshaler, aren't checked.
+func jsonTypeErrors(b []byte, t reflect.Type, verr *ValidationError) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return
+	}
+	checkJSONType(v, t, "", verr)
+}
+
+func checkJSONType(v interface{}, t reflect.Type, path string, verr *ValidationError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if v == nil || t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(jsonUnmarshalerType) {
+		return
+	}
+	if _, isString := v.(string); isString && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return
+	}
+
+	ok := true
+	switch t.Kind() {
+	case reflect.Struct:
+		var obj map[string]interface{}
+		if obj, ok = v.(map[string]interface{}); ok {
+			for _, key := range sortedKeys(obj) {
+				if field, found := jsonField(t, key); found {
+					checkJSONType(obj[key], field.Type, joinJSONPath(path, key), verr)
+				}
+			}
+		}
+	case reflect.Map:
+		var obj map[string]interface{}
+		if obj, ok = v.(map[string]interface{}); ok {
+			for _, key := range sortedKeys(obj) {
+				checkJSONType(obj[key], t.Elem(), joinJSONPath(path, key), verr)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			// byte slices are base64 encoded strings
+			_, ok = v.(string)
+			break
+		}
+		var arr []interface{}
+		if arr, ok = v.([]interface{}); ok {
+			for i, val := range arr {
+				checkJSONType(val, t.Elem(), path+"["+strconv.Itoa(i)+"]", verr)
+			}
+		}
+	case reflect.String:
+		_, ok = v.(string)
+	case reflect.Bool:
+		_, ok = v.(bool)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, isNumber := v.(json.Number)
+		_, err := strconv.ParseInt(string(n), 10, t.Bits())
+		ok = isNumber && err == nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, isNumber := v.(json.Number)
+		_, err := strconv.ParseUint(string(n), 10, t.Bits())
+		ok = isNumber && err == nil
+	case reflect.Float32, reflect.Float64:
+		_, ok = v.(json.Number)
+	}
+	if !ok {
+		if path == "" {
+			path = "body"
+		}
+		verr.AddErrorDetailed(path, ErrCodeSyntaxError, nil, "Expected a value of type %v, got %s", t, jsonKind(v))
+	}
+}
+
+// jsonField returns the field of the struct type t that encoding/json decodes the object key into,
+// including fields of embedded structs. Keys match field names case-insensitively, as for encoding/json.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	var fold *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if ef, found := jsonField(ft, key); found {
+					return ef, true
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if name == key {
+			return f, true
+		} else if fold == nil && strings.EqualFold(name, key) {
+			f := f
+			fold = &f
+		}
+	}
+	if fold != nil {
+		return *fold, true
+	}
+	return reflect.StructField{}, false
+}
+
+// sortedKeys returns the keys of obj in order, so errors are reported in a stable order.
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonKind names the kind of a generically decoded JSON value.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
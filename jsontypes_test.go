@@ -0,0 +1,67 @@
+package milk
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type jsonTypesBase struct {
+	Owner string `json:"owner"`
+}
+
+type jsonTypesDoc struct {
+	jsonTypesBase
+	Title    string            `json:"title"`
+	Count    int8              `json:"count"`
+	Size     uint              `json:"size"`
+	Ratio    float64           `json:"ratio"`
+	Done     *bool             `json:"done"`
+	Data     []byte            `json:"data"`
+	Grid     [2][]int          `json:"grid"`
+	Labels   map[string]string `json:"labels"`
+	Any      interface{}       `json:"any"`
+	When     time.Time         `json:"when"`
+	Skipped  int               `json:"-"`
+	Untagged int
+	hidden   int
+}
+
+func TestJSONTypeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{
+			name: "valid",
+			body: `{"owner":"a","title":"t","count":1,"size":2,"ratio":0.5,"done":null,"data":"YQ==","grid":[[1],[2]],` +
+				`"labels":{"a":"b"},"any":[1,"x"],"when":"2021-06-01T00:00:00Z","Skipped":"x","-":"x","untagged":1,"hidden":"x","extra":[]}`,
+		},
+		{name: "embedded field", body: `{"owner":1}`, want: []string{"owner: Expected a value of type string, got number"}},
+		{name: "out of range", body: `{"count":300,"size":-1}`, want: []string{"count: Expected a value of type int8, got number", "size: Expected a value of type uint, got number"}},
+		{name: "fraction for integer", body: `{"count":1.5}`, want: []string{"count: Expected a value of type int8, got number"}},
+		{name: "pointer", body: `{"done":"yes"}`, want: []string{"done: Expected a value of type bool, got string"}},
+		{name: "bytes", body: `{"data":[1]}`, want: []string{"data: Expected a value of type []uint8, got array"}},
+		{name: "nested arrays", body: `{"grid":[[1,"x"],{}]}`, want: []string{"grid[0][1]: Expected a value of type int, got string", "grid[1]: Expected a value of type []int, got object"}},
+		{name: "map values", body: `{"labels":{"b":1,"a":true}}`, want: []string{"labels.a: Expected a value of type string, got boolean", "labels.b: Expected a value of type string, got number"}},
+		{name: "case-insensitive key", body: `{"TITLE":false}`, want: []string{"TITLE: Expected a value of type string, got boolean"}},
+		{name: "unmarshaler", body: `{"when":5}`},
+		{name: "document", body: `[]`, want: []string{"body: Expected a value of type milk.jsonTypesDoc, got array"}},
+		{name: "malformed", body: `{"title":`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verr := NewValidationError()
+			jsonTypeErrors([]byte(test.body), reflect.TypeOf(&jsonTypesDoc{}), verr)
+			var got []string
+			for _, e := range verr.Errors {
+				got = append(got, e.FieldName+": "+e.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
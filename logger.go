@@ -0,0 +1,80 @@
+package milk
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Logger logs the messages of a request, including the messages logged by the package itself.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// stdLogger is the default Logger, logging with the standard log package.
+type stdLogger struct{}
+
+func (stdLogger) Debugf(format string, args ...interface{}) {
+	log.Printf("DEBUG: "+format, args...)
+}
+
+func (stdLogger) Infof(format string, args ...interface{}) {
+	log.Printf("INFO: "+format, args...)
+}
+
+func (stdLogger) Warningf(format string, args ...interface{}) {
+	log.Printf("WARNING: "+format, args...)
+}
+
+func (stdLogger) Errorf(format string, args ...interface{}) {
+	log.Printf("ERROR: "+format, args...)
+}
+
+// LogEntry is a message logged to a RecordingLogger.
+type LogEntry struct {
+	Level   string // Level is one of "DEBUG", "INFO", "WARNING" and "ERROR"
+	Message string
+}
+
+// RecordingLogger is a Logger recording the logged messages, for asserting on logging in tests:
+//
+//	logger := &milk.RecordingLogger{}
+//	router.NewLogger = func(c *milk.Context) milk.Logger { return logger }
+//
+// It is safe for concurrent use.
+type RecordingLogger struct {
+	mu      sync.Mutex
+	entries []LogEntry
+}
+
+// Entries returns the messages logged so far, in the order they were logged.
+func (this *RecordingLogger) Entries() []LogEntry {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return append([]LogEntry(nil), this.entries...)
+}
+
+func (this *RecordingLogger) record(level, format string, args []interface{}) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.entries = append(this.entries, LogEntry{Level: level, Message: fmt.Sprintf(format, args...)})
+}
+
+func (this *RecordingLogger) Debugf(format string, args ...interface{}) {
+	this.record("DEBUG", format, args)
+}
+
+func (this *RecordingLogger) Infof(format string, args ...interface{}) {
+	this.record("INFO", format, args)
+}
+
+func (this *RecordingLogger) Warningf(format string, args ...interface{}) {
+	this.record("WARNING", format, args)
+}
+
+func (this *RecordingLogger) Errorf(format string, args ...interface{}) {
+	this.record("ERROR", format, args)
+}
@@ -0,0 +1,67 @@
+package milk
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRecordingLogger(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l Logger)
+		want []LogEntry
+	}{
+		{name: "nothing"},
+		{
+			name: "every level",
+			log: func(l Logger) {
+				l.Debugf("d")
+				l.Infof("i %d", 1)
+				l.Warningf("w %s", "x")
+				l.Errorf("e %v", true)
+			},
+			want: []LogEntry{{"DEBUG", "d"}, {"INFO", "i 1"}, {"WARNING", "w x"}, {"ERROR", "e true"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			logger := &RecordingLogger{}
+			if test.log != nil {
+				test.log(logger)
+			}
+			entries := logger.Entries()
+			if len(entries) != len(test.want) {
+				t.Fatalf("expected %v, got %v", test.want, entries)
+			}
+			for i := range entries {
+				if entries[i] != test.want[i] {
+					t.Errorf("entry %d: expected %v, got %v", i, test.want[i], entries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRecordingLoggerConcurrency(t *testing.T) {
+	logger := &RecordingLogger{}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Infof("%d", i)
+				logger.Entries()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(logger.Entries()); n != 1000 {
+		t.Errorf("expected 1000 entries, got %d", n)
+	}
+	entries := logger.Entries()
+	entries[0].Message = "changed"
+	if logger.Entries()[0].Message == "changed" {
+		t.Error("expected Entries to return a copy")
+	}
+}
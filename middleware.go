@@ -0,0 +1,33 @@
+package milk
+
+import (
+	"net/http"
+)
+
+// AllowAllCORS sets response headers allowing cross-origin requests from any origin.
+// Credentials aren't allowed, as browsers reject credentialed responses allowing any origin.
+func AllowAllCORS(c *Context) error {
+	c.W.Header().Set("Access-Control-Allow-Origin", "*")
+	return nil
+}
+
+// CORSPreflight answers CORS preflight (OPTIONS) requests with the allowed methods and headers
+// and stops the chain, so no downstream handlers run for the preflight request.
+// Requests with any other method are passed through untouched.
+// OPTIONS requests to paths without an OPTIONS route only run the middleware of the root router,
+// so register it with Use on the root router, before any middleware rejecting requests, like authentication.
+func CORSPreflight(c *Context) error {
+	if c.R.Method != "OPTIONS" {
+		return nil
+	}
+	h := c.W.Header()
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	if reqHeaders := c.R.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	h.Set("Access-Control-Max-Age", "86400")
+	c.W.WriteHeader(http.StatusOK)
+	c.Stop()
+	return nil
+}
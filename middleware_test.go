@@ -0,0 +1,84 @@
+package milk
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		options bool // register an explicit OPTIONS route
+		status  int
+		header  map[string]string
+		handled bool // whether the GET handler runs
+	}{
+		{
+			name: "preflight", method: "OPTIONS", status: 200,
+			header: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Methods": "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+				"Access-Control-Allow-Headers": "Content-Type",
+				"Access-Control-Max-Age":       "86400",
+			},
+		},
+		{
+			name: "preflight to an explicit OPTIONS route", method: "OPTIONS", options: true, status: 200,
+			header: map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Max-Age": "86400"},
+		},
+		{
+			name: "get", method: "GET", status: 200, handled: true,
+			header: map[string]string{
+				"Access-Control-Allow-Origin":      "*",
+				"Access-Control-Allow-Methods":     "",
+				"Access-Control-Allow-Credentials": "",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Use(CORSPreflight, AllowAllCORS)
+			handled := false
+			r.Get("/x", func(c *Context) error {
+				handled = true
+				return nil
+			})
+			if test.options {
+				r.Options("/x", func(c *Context) error {
+					t.Error("the OPTIONS route ran after the preflight was answered")
+					return nil
+				})
+			}
+			w := serveRequest(r, test.method, "/x", nil, "Origin", "https://example.com", "Access-Control-Request-Headers", "Content-Type")
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			for name, val := range test.header {
+				if got := w.Header().Get(name); got != val {
+					t.Errorf("expected %s header %q, got %q", name, val, got)
+				}
+			}
+			if handled != test.handled {
+				t.Errorf("expected the GET handler to run: %v, ran: %v", test.handled, handled)
+			}
+		})
+	}
+}
+
+func TestAutomaticOptionsWithoutMiddleware(t *testing.T) {
+	r, _ := newTestRouter()
+	r.Get("/x", func(c *Context) error { return nil })
+	r.Post("/x", func(c *Context) error { return nil })
+	w := serveRequest(r, "OPTIONS", "/x", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS, POST" {
+		t.Errorf("expected the Allow header to list the registered methods, got %q", allow)
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") != "" || w.Body.Len() != 0 {
+		t.Errorf("expected an empty response without CORS headers, got %v %s", w.Header(), w.Body.String())
+	}
+}
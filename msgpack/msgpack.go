@@ -0,0 +1,42 @@
+// Package msgpack encodes the responses and decodes the request bodies of milk routers as MessagePack.
+// It's a separate module, so milk itself remains free of dependencies on encoding libraries.
+//
+//	r := milk.NewRouter()
+//	msgpack.Register(r)
+//
+// Values are encoded with github.com/vmihailenco/msgpack by the names of their json tags, so the structs of
+// JSON requests and responses, including the error payloads, are sent with the same keys in both encodings.
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/snechholt/milk"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ContentType is the content type of MessagePack requests and responses.
+const ContentType = "application/msgpack"
+
+// Register registers the MessagePack encoding for ContentType on the router and its sub-routers.
+func Register(r *milk.Router) {
+	r.RegisterCodec(ContentType, Marshal, Unmarshal)
+}
+
+// Marshal encodes v as MessagePack, naming fields by their json tags.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes the MessagePack data into v, naming fields by their json tags.
+func Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
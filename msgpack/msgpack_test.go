@@ -0,0 +1,143 @@
+package msgpack
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/snechholt/milk"
+)
+
+// item is the body item of the JSON tests of milk.
+type item struct {
+	Name  string `json:"name" xml:"name"`
+	Price int    `json:"price" xml:"price"`
+}
+
+func (this *item) Validate() *milk.ValidationError {
+	verr := milk.NewValidationError()
+	if this.Name == "" {
+		verr.AddError("name", milk.ErrCodeRequired)
+	}
+	if this.Price < 0 {
+		verr.AddError("price", milk.ErrCodeValueTooLow)
+	}
+	return verr
+}
+
+// errorPayload is the error payload of a response.
+type errorPayload struct {
+	StatusCode int                `json:"statusCode"`
+	ErrorCode  string             `json:"errorCode"`
+	Message    string             `json:"message"`
+	Errors     []*milk.FieldError `json:"errors"`
+}
+
+func newTestRouter() *milk.Router {
+	r := milk.NewRouter()
+	r.NewLogger = func(c *milk.Context) milk.Logger { return &milk.RecordingLogger{} }
+	Register(r)
+	r.Post("/items", func(c *milk.Context) error {
+		var item item
+		if err := c.ParseBody(&item); err != nil {
+			return err
+		}
+		item.Price *= 2
+		c.Result = &item
+		return nil
+	})
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        func() []byte
+		accept      string
+		status      int
+		respType    string
+		want        interface{} // a pointer to the expected response
+	}{
+		{
+			name:        "msgpack round trip",
+			contentType: ContentType, body: func() []byte { return marshal(t, item{Name: "a", Price: 21}) },
+			accept: ContentType, status: 200, respType: ContentType,
+			want: &item{Name: "a", Price: 42},
+		},
+		{
+			name:        "json to msgpack",
+			contentType: "application/json", body: func() []byte { return []byte(`{"name":"a","price":21}`) },
+			accept: ContentType, status: 200, respType: ContentType,
+			want: &item{Name: "a", Price: 42},
+		},
+		{
+			name:        "validation error",
+			contentType: ContentType, body: func() []byte { return marshal(t, item{Price: -1}) },
+			accept: ContentType, status: 422, respType: ContentType,
+			want: &errorPayload{
+				StatusCode: 422, ErrorCode: "multi", Message: "Validation error. See errors array for details.",
+				Errors: []*milk.FieldError{
+					{FieldName: "name", ErrorCode: milk.ErrCodeRequired},
+					{FieldName: "price", ErrorCode: milk.ErrCodeValueTooLow},
+				},
+			},
+		},
+		{
+			name:        "malformed body",
+			contentType: ContentType, body: func() []byte { return []byte{0xc1} },
+			accept: ContentType, status: 422, respType: ContentType,
+			want: &errorPayload{
+				StatusCode: 422, ErrorCode: "multi", Message: "Validation error. See errors array for details.",
+				Errors: []*milk.FieldError{
+					{FieldName: "body", ErrorCode: milk.ErrCodeSyntaxError, Message: "Invalid request body"},
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/items", bytes.NewReader(test.body()))
+			req.Header.Set("Content-Type", test.contentType)
+			req.Header.Set("Accept", test.accept)
+			w := httptest.NewRecorder()
+			newTestRouter().ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %q", test.status, w.Code, w.Body)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != test.respType {
+				t.Errorf("expected content type %s, got %s", test.respType, contentType)
+			}
+			got := reflect.New(reflect.TypeOf(test.want).Elem()).Interface()
+			if err := Unmarshal(w.Body.Bytes(), got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %+v, got %+v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMsgpackToJSON(t *testing.T) {
+	req := httptest.NewRequest("POST", "/items", bytes.NewReader(marshal(t, item{Name: "a", Price: 21})))
+	req.Header.Set("Content-Type", ContentType)
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"name":"a","price":42}` {
+		t.Errorf(`expected body {"name":"a","price":42}, got %s`, body)
+	}
+}
+
+func marshal(t *testing.T, v interface{}) []byte {
+	b, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
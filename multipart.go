@@ -0,0 +1,91 @@
+package milk
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// DefaultMultipartMemory is the maximum number of bytes of a multipart body kept in memory when the
+// body is parsed implicitly by FormFile, ParsePart or Bind. The remainder is stored in temporary files.
+var DefaultMultipartMemory int64 = 32 << 20
+
+// ParseMultipart parses the request body as multipart/form-data, keeping up to maxMemory bytes of
+// file parts in memory. The body is limited to the router's MaxBodySize; larger bodies result in
+// ErrRequestEntityTooLarge. Requests that aren't multipart result in ErrUnsupportedMediaType.
+// Once parsed, the form is available from R.MultipartForm.
+func (this *Context) ParseMultipart(maxMemory int64) error {
+	if this.R.MultipartForm != nil {
+		return nil
+	}
+	this.R.Body = http.MaxBytesReader(this.w.w, this.R.Body, this.maxBodySize())
+	if err := this.R.ParseMultipartForm(maxMemory); err != nil {
+		var sizeErr *http.MaxBytesError
+		if errors.As(err, &sizeErr) {
+			return ErrRequestEntityTooLarge
+		} else if err == http.ErrNotMultipart || err == http.ErrMissingBoundary {
+			return ErrUnsupportedMediaType
+		}
+		this.Debugf("error parsing multipart body: %v", err)
+		return ErrBadRequest
+	}
+	return nil
+}
+
+// FormFile returns the first file of the multipart body with the given form name, parsing the body
+// if that has not already been done. A missing file results in a ValidationError with ErrCodeRequired.
+func (this *Context) FormFile(name string) (multipart.File, *multipart.FileHeader, error) {
+	if err := this.ParseMultipart(DefaultMultipartMemory); err != nil {
+		return nil, nil, err
+	}
+	if fhs := this.R.MultipartForm.File[name]; len(fhs) > 0 {
+		f, err := fhs[0].Open()
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, fhs[0], nil
+	}
+	verr := NewValidationError()
+	verr.AddError(name, ErrCodeRequired)
+	return nil, nil, verr
+}
+
+// ParsePart decodes the part of the multipart body with the given form name as JSON into dst,
+// e.g. for metadata sent alongside an uploaded file. The part may be either a file or a value.
+// A missing part results in a ValidationError with ErrCodeRequired; malformed JSON in a
+// ValidationError with ErrCodeSyntaxError, both keyed by the name.
+func (this *Context) ParsePart(name string, dst interface{}) error {
+	if err := this.ParseMultipart(DefaultMultipartMemory); err != nil {
+		return err
+	}
+	var r io.Reader
+	if vals := this.R.MultipartForm.Value[name]; len(vals) > 0 {
+		r = strings.NewReader(vals[0])
+	} else if fhs := this.R.MultipartForm.File[name]; len(fhs) > 0 {
+		f, err := fhs[0].Open()
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	} else {
+		verr := NewValidationError()
+		verr.AddError(name, ErrCodeRequired)
+		return verr
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading multipart part %s: %v", name, err)
+	}
+	if err := Unmarshal(b, dst); err != nil {
+		this.Debugf("error parsing multipart part %s: %v", name, err)
+		verr := NewValidationError()
+		verr.AddErrorDetailed(name, ErrCodeSyntaxError, nil, "Invalid JSON")
+		return verr
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package milk
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+)
+
+// uploadBody returns a multipart/form-data body with a file part named "file" if file is set, a JSON value
+// part named "meta" if meta is set, and its content type.
+func uploadBody(t *testing.T, file, meta string) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if file != "" {
+		fw, err := mw.CreateFormFile("file", "notes.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(fw, file)
+	}
+	if meta != "" {
+		mw.WriteField("meta", meta)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func TestMultipart(t *testing.T) {
+	tests := []struct {
+		name        string
+		file        string
+		meta        string
+		contentType string // contentType replaces the content type of the body if set
+		maxBodySize int64
+		status      int
+		want        string
+		errors      []string
+	}{
+		{name: "file and metadata", file: "hello", meta: `{"name":"a","price":1}`, status: 200, want: "notes.txt 5 hello a"},
+		{name: "missing file", meta: `{"name":"a"}`, status: 422, errors: []string{"file required"}},
+		{name: "missing metadata", file: "hello", status: 422, errors: []string{"meta required"}},
+		{name: "malformed metadata", file: "hello", meta: `{"name":`, status: 422, errors: []string{"meta syntax-error"}},
+		{name: "not multipart", file: "hello", contentType: "application/json", status: 415},
+		{name: "missing boundary", file: "hello", contentType: "multipart/form-data", status: 415},
+		{name: "too large", file: strings.Repeat("x", 1000), maxBodySize: 100, status: 413},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.MaxBodySize = test.maxBodySize
+			r.Post("/upload", func(c *Context) error {
+				f, fh, err := c.FormFile("file")
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				b, err := io.ReadAll(f)
+				if err != nil {
+					return err
+				}
+				var meta bodyItem
+				if err := c.ParsePart("meta", &meta); err != nil {
+					return err
+				}
+				c.Result = fmt.Sprintf("%s %d %s %s", fh.Filename, fh.Size, b, meta.Name)
+				return nil
+			})
+			body, contentType := uploadBody(t, test.file, test.meta)
+			if test.contentType != "" {
+				contentType = test.contentType
+			}
+			w := serveRequest(r, "POST", "/upload", body, "Content-Type", contentType)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if test.errors != nil {
+				if got := fieldErrors(t, w.Body.String()); strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected errors %q, got %q", test.errors, got)
+				}
+			} else if test.want != "" && strings.TrimSpace(w.Body.String()) != `"`+test.want+`"` {
+				t.Errorf("expected %q, got %s", test.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestParsePartFromFile(t *testing.T) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fw, _ := mw.CreateFormFile("meta", "meta.json")
+	io.WriteString(fw, `{"name":"from file"}`)
+	mw.Close()
+
+	r, _ := newTestRouter()
+	r.Post("/upload", func(c *Context) error {
+		var meta bodyItem
+		if err := c.ParsePart("meta", &meta); err != nil {
+			return err
+		}
+		c.Result = meta.Name
+		return nil
+	})
+	w := serveRequest(r, "POST", "/upload", &buf, "Content-Type", mw.FormDataContentType())
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `"from file"` {
+		t.Errorf("expected the JSON file part to be parsed, got %d %s", w.Code, w.Body)
+	}
+}
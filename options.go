@@ -0,0 +1,50 @@
+package milk
+
+import (
+	"github.com/julienschmidt/httprouter"
+)
+
+// RouterOption configures a Router created by NewRouter.
+type RouterOption func(*Router)
+
+// WithBackend makes the router use backends created by newBackend rather than the default httprouter based backend.
+// newBackend is called once for the router and once for every router created by Router.Host.
+func WithBackend(newBackend func() Backend) RouterOption {
+	return func(r *Router) {
+		r.newBackend = newBackend
+	}
+}
+
+// WithRedirectTrailingSlash sets whether requests for a path with (without) a trailing slash are redirected
+// to the path without (with) the slash when only that route exists. Enabled by default.
+// Only applies to the default httprouter based backend.
+func WithRedirectTrailingSlash(enabled bool) RouterOption {
+	return withHTTPRouter(func(r *httprouter.Router) {
+		r.RedirectTrailingSlash = enabled
+	})
+}
+
+// WithRedirectFixedPath sets whether requests for paths with superfluous elements (like ../ or //) or
+// wrong casing are redirected to the cleaned path when a route exists for it. Enabled by default.
+// Only applies to the default httprouter based backend.
+func WithRedirectFixedPath(enabled bool) RouterOption {
+	return withHTTPRouter(func(r *httprouter.Router) {
+		r.RedirectFixedPath = enabled
+	})
+}
+
+// WithHandleMethodNotAllowed sets whether requests whose path matches a route registered for another method
+// are answered by the router's MethodNotAllowed handler rather than the NotFound handler. Enabled by default.
+// Only applies to the default httprouter based backend.
+func WithHandleMethodNotAllowed(enabled bool) RouterOption {
+	return withHTTPRouter(func(r *httprouter.Router) {
+		r.HandleMethodNotAllowed = enabled
+	})
+}
+
+// withHTTPRouter returns a RouterOption applying fn to the httprouter.Router of default backends.
+func withHTTPRouter(fn func(*httprouter.Router)) RouterOption {
+	return func(r *Router) {
+		r.httprouterOpts = append(r.httprouterOpts, fn)
+	}
+}
@@ -0,0 +1,150 @@
+package milk
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PaginationDefaults configures the parameters read by Params.Pagination.
+type PaginationDefaults struct {
+	Limit    int  // Limit used when the limit parameter is missing
+	MaxLimit int  // Larger limits are clamped to MaxLimit. No maximum if 0.
+	Pages    bool // Read a 1-based page number instead of an offset, e.g. ?limit=20&page=3
+
+	LimitKey  string // Name of the limit parameter. Defaults to "limit".
+	OffsetKey string // Name of the offset parameter. Defaults to "offset".
+	PageKey   string // Name of the page number parameter. Defaults to "page".
+}
+
+// Page is a page of a list, as requested by the limit and offset or page number parameters of a request.
+type Page struct {
+	Limit  int
+	Offset int
+	Number int // 1-based page number, when read in page number mode
+}
+
+// PageMeta is response metadata for a Page, for including in list responses.
+type PageMeta struct {
+	Limit   int  `json:"limit" xml:"limit"`
+	Offset  int  `json:"offset" xml:"offset"`
+	Page    int  `json:"page,omitempty" xml:"page,omitempty"`
+	HasMore bool `json:"hasMore" xml:"hasMore"`
+}
+
+// Pagination returns the Page requested by the limit and offset, or page number, parameters of the request.
+// Missing limits get the default limit, and limits above the max limit are clamped to it.
+// Negative values, page numbers below 1 or with an offset overflowing an int and non-integer values result in
+// a ValidationError.
+//
+//	page, err := c.Params.Pagination(milk.PaginationDefaults{Limit: 20, MaxLimit: 100})
+//	if err != nil {
+//		return err
+//	}
+//	items := fetch(page.Offset, page.FetchLimit())
+func (this *Params) Pagination(defaults PaginationDefaults) (Page, error) {
+	limitKey, offsetKey, pageKey := defaults.LimitKey, defaults.OffsetKey, defaults.PageKey
+	if limitKey == "" {
+		limitKey = "limit"
+	}
+	if offsetKey == "" {
+		offsetKey = "offset"
+	}
+	if pageKey == "" {
+		pageKey = "page"
+	}
+
+	verr := NewValidationError()
+	page := Page{Limit: this.pageParam(limitKey, defaults.Limit, 0, verr)}
+	if defaults.MaxLimit > 0 && page.Limit > defaults.MaxLimit {
+		page.Limit = defaults.MaxLimit
+	}
+	if defaults.Pages {
+		page.Number = this.pageParam(pageKey, 1, 1, verr)
+		if page.Limit > 0 && page.Number-1 > math.MaxInt/page.Limit {
+			verr.AddErrorDetailed(pageKey, ErrCodeValueTooHigh, math.MaxInt/page.Limit+1, "")
+		} else {
+			page.Offset = (page.Number - 1) * page.Limit
+		}
+	} else {
+		page.Offset = this.pageParam(offsetKey, 0, 0, verr)
+	}
+	if verr.HasErrors() {
+		return Page{}, verr
+	}
+	return page, nil
+}
+
+// pageParam returns the given key's value, or def if it's missing, adding an error to verr if it's invalid or below min.
+func (this *Params) pageParam(key string, def int, min int, verr *ValidationError) int {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return def
+	}
+	val, err := strconv.Atoi(strVal)
+	if err != nil {
+		verr.AddError(key, ErrCodeSyntaxError)
+	} else if val < min {
+		verr.AddErrorDetailed(key, ErrCodeValueTooLow, min, "")
+	}
+	return val
+}
+
+// FetchLimit returns the number of items to fetch for the page: one more than the limit, for Meta to tell if
+// there are more items after the page.
+func (this Page) FetchLimit() int {
+	return this.Limit + 1
+}
+
+// Meta returns the response metadata for the page, given the number of items fetched with FetchLimit.
+func (this Page) Meta(fetched int) PageMeta {
+	return PageMeta{
+		Limit:   this.Limit,
+		Offset:  this.Offset,
+		Page:    this.Number,
+		HasMore: fetched > this.Limit,
+	}
+}
+
+// SortField is a field to sort a list by, as requested by the sort parameter of a request.
+type SortField struct {
+	Name string
+	Desc bool
+}
+
+// Sort returns the fields requested by the sort parameter, e.g. ?sort=-createdAt,name for sorting by createdAt
+// descending, then by name. Only the allowed fields may be requested; an allowed field of the form
+// "created=created_at" accepts "created" and returns the field as "created_at". The fields are returned in the
+// requested order. Unknown fields result in a ValidationError with ErrCodeInvalidState and repeated fields
+// in one with ErrCodeDuplicate, both with the field in the error's data.
+func (this *Params) Sort(allowed ...string) ([]SortField, error) {
+	names := make(map[string]string, len(allowed))
+	for _, field := range allowed {
+		if i := strings.IndexByte(field, '='); i >= 0 {
+			names[field[:i]] = field[i+1:]
+		} else {
+			names[field] = field
+		}
+	}
+	var fields []SortField
+	seen := make(map[string]bool)
+	verr := NewValidationError()
+	for _, val := range this.GetStrings("sort") {
+		field := SortField{Name: strings.TrimPrefix(val, "-"), Desc: strings.HasPrefix(val, "-")}
+		name, ok := names[field.Name]
+		if !ok {
+			verr.AddErrorDetailed("sort", ErrCodeInvalidState, field.Name, "Unknown sort field %s", field.Name)
+			continue
+		} else if seen[name] {
+			verr.AddErrorDetailed("sort", ErrCodeDuplicate, field.Name, "Repeated sort field %s", field.Name)
+			continue
+		}
+		seen[name] = true
+		field.Name = name
+		fields = append(fields, field)
+	}
+	if verr.HasErrors() {
+		return nil, verr
+	}
+	return fields, nil
+}
@@ -0,0 +1,130 @@
+package milk
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		defaults PaginationDefaults
+		want     Page
+		errors   []string
+	}{
+		{name: "defaults", url: "/x", defaults: PaginationDefaults{Limit: 20}, want: Page{Limit: 20}},
+		{name: "limit and offset", url: "/x?limit=10&offset=30", defaults: PaginationDefaults{Limit: 20}, want: Page{Limit: 10, Offset: 30}},
+		{name: "clamped", url: "/x?limit=1000", defaults: PaginationDefaults{Limit: 20, MaxLimit: 100}, want: Page{Limit: 100}},
+		{name: "zero limit", url: "/x?limit=0", defaults: PaginationDefaults{Limit: 20}, want: Page{Limit: 0}},
+		{name: "pages", url: "/x?limit=10&page=3", defaults: PaginationDefaults{Limit: 20, Pages: true}, want: Page{Limit: 10, Offset: 20, Number: 3}},
+		{name: "first page", url: "/x", defaults: PaginationDefaults{Limit: 20, Pages: true}, want: Page{Limit: 20, Number: 1}},
+		{
+			name: "custom keys", url: "/x?size=5&skip=15",
+			defaults: PaginationDefaults{Limit: 20, LimitKey: "size", OffsetKey: "skip"}, want: Page{Limit: 5, Offset: 15},
+		},
+		{name: "negative", url: "/x?limit=-1&offset=-5", defaults: PaginationDefaults{Limit: 20}, errors: []string{"limit value-too-low", "offset value-too-low"}},
+		{name: "page zero", url: "/x?page=0", defaults: PaginationDefaults{Limit: 20, Pages: true}, errors: []string{"page value-too-low"}},
+		{
+			name: "page overflowing the offset", url: "/x?page=922337203685477581&limit=20",
+			defaults: PaginationDefaults{Limit: 20, Pages: true}, errors: []string{"page value-too-high"},
+		},
+		{
+			name: "last page not overflowing the offset", url: fmt.Sprintf("/x?page=%d&limit=20", math.MaxInt/20+1),
+			defaults: PaginationDefaults{Limit: 20, Pages: true}, want: Page{Limit: 20, Offset: math.MaxInt / 20 * 20, Number: math.MaxInt/20 + 1},
+		},
+		{name: "not integers", url: "/x?limit=ten&offset=1.5", defaults: PaginationDefaults{Limit: 20}, errors: []string{"limit syntax-error", "offset syntax-error"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var page Page
+			var err error
+			r.Get("/x", func(c *Context) error { page, err = c.Params.Pagination(test.defaults); return nil })
+			serveRequest(r, "GET", test.url, nil)
+			if test.errors != nil {
+				verr, _ := err.(*ValidationError)
+				if got := validationErrors(verr); strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected errors %q, got %v", test.errors, err)
+				}
+			} else if err != nil || page != test.want {
+				t.Errorf("expected %+v, got %+v, %v", test.want, page, err)
+			}
+		})
+	}
+}
+
+func TestPageMeta(t *testing.T) {
+	tests := []struct {
+		page    Page
+		fetched int
+		want    PageMeta
+	}{
+		{page: Page{Limit: 10}, fetched: 11, want: PageMeta{Limit: 10, HasMore: true}},
+		{page: Page{Limit: 10, Offset: 10}, fetched: 10, want: PageMeta{Limit: 10, Offset: 10}},
+		{page: Page{Limit: 10, Offset: 20, Number: 3}, fetched: 2, want: PageMeta{Limit: 10, Offset: 20, Page: 3}},
+	}
+	for _, test := range tests {
+		if test.page.FetchLimit() != test.page.Limit+1 {
+			t.Errorf("expected a fetch limit of %d, got %d", test.page.Limit+1, test.page.FetchLimit())
+		}
+		if got := test.page.Meta(test.fetched); got != test.want {
+			t.Errorf("%+v with %d fetched: expected %+v, got %+v", test.page, test.fetched, test.want, got)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	allowed := []string{"name", "created=created_at"}
+	tests := []struct {
+		name   string
+		url    string
+		want   string
+		errors []string
+	}{
+		{name: "none", url: "/x", want: "[]"},
+		{name: "ascending", url: "/x?sort=name", want: "[{name false}]"},
+		{name: "mapped and descending first", url: "/x?sort=-created,name", want: "[{created_at true} {name false}]"},
+		{name: "repeated parameter", url: "/x?sort=name&sort=-created", want: "[{name false} {created_at true}]"},
+		{name: "unknown", url: "/x?sort=name,-size", errors: []string{"sort invalid-state size"}},
+		{name: "unmapped name", url: "/x?sort=created_at", errors: []string{"sort invalid-state created_at"}},
+		{name: "duplicate", url: "/x?sort=name,-name", errors: []string{"sort duplicate name"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var fields []SortField
+			var err error
+			r.Get("/x", func(c *Context) error { fields, err = c.Params.Sort(allowed...); return nil })
+			serveRequest(r, "GET", test.url, nil)
+			if test.errors != nil {
+				verr, _ := err.(*ValidationError)
+				var got []string
+				if verr != nil {
+					for _, e := range verr.Errors {
+						got = append(got, fmt.Sprint(e.FieldName, " ", e.ErrorCode, " ", e.Data))
+					}
+				}
+				if strings.Join(got, ",") != strings.Join(test.errors, ",") {
+					t.Errorf("expected errors %q, got %v", test.errors, err)
+				}
+			} else if err != nil || fmt.Sprint(fields) != test.want {
+				t.Errorf("expected %s, got %v, %v", test.want, fields, err)
+			}
+		})
+	}
+}
+
+// validationErrors returns the errors of verr as "key code" strings.
+func validationErrors(verr *ValidationError) []string {
+	if verr == nil {
+		return nil
+	}
+	var errs []string
+	for _, e := range verr.Errors {
+		errs = append(errs, e.FieldName+" "+e.ErrorCode)
+	}
+	return errs
+}
@@ -1,20 +1,48 @@
 package milk
 
 import (
-	"github.com/julienschmidt/httprouter"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
+	"strings"
 	"time"
 )
 
-// DateFormat is the date format used when parsing a date in Params.GetDate()
+// DateFormat is the date format used when parsing a date in Params.GetDate() for routers without DateFormats.
 var DateFormat = "2006-01-02"
 
+// DefaultDurationUnit is the unit of bare integer durations in Params.GetDuration(), e.g. seconds for ?ttl=300,
+// for routers without a DurationUnit. Set it to 0 to reject bare integers other than 0, as time.ParseDuration does.
+var DefaultDurationUnit = time.Second
+
+// DefaultMaxJSONParamSize is the maximum length in bytes of values decoded by Params.GetJSON(),
+// unless a different size is set on the router (see Router.MaxJSONParamSize).
+var DefaultMaxJSONParamSize = 8 << 10
+
+// DefaultMaxBase64ParamSize is the maximum size in bytes of values decoded by Params.GetBase64(),
+// unless a different size is set on the router (see Router.MaxBase64ParamSize).
+var DefaultMaxBase64ParamSize = 8 << 10
+
+// ErrParamMissing is returned by the accessors of Params, Headers and Cookies returning errors for keys missing from the request.
+var ErrParamMissing = errors.New("milk: parameter missing")
+
 // Params provides access to parameters in the URL and querystring of a request.
+// The request path is searched first and overrides any querystring values with the same key.
 type Params struct {
+	valueSource
+
 	r *http.Request
-	p httprouter.Params
+	p PathParams
 	o map[string]string
+
+	q url.Values // parsed querystring, see query
+
+	router *Router
 }
 
 func (this *Params) Override(key string, value string) {
@@ -24,49 +52,404 @@ func (this *Params) Override(key string, value string) {
 	this.o[key] = value
 }
 
-// Get returns the given key's value from the request path parameters or querystring.
-// The request path is searched first and overrides any querystring values with the same key.
-func (this *Params) Get(key string) string {
+// lookup returns the given key's value from the request path parameters or querystring, and whether it's present.
+func (this *Params) lookup(key string) (string, bool) {
 	if val, ok := this.o[key]; ok {
-		return val
+		return val, true
+	}
+	if this.p != nil {
+		if val := this.p.ByName(key); val != "" {
+			return val, true
+		}
 	}
-	if val := this.p.ByName(key); val != "" {
-		return val
-	} else {
-		return this.r.URL.Query().Get(key)
+	vals, ok := this.query()[key]
+	if len(vals) == 0 {
+		return "", ok
 	}
+	return vals[0], true
 }
 
-// GetInt64 returns the given key's value as an int.
-// Returns 0 for invalid or missing values.
-// The request path is searched first and overrides any querystring values with the same key.
-func (this *Params) GetInt(key string) int {
-	if strVal := this.Get(key); strVal != "" {
-		if intVal, err := strconv.Atoi(strVal); err == nil {
-			return intVal
+// GetStrings returns the given key's values from repeated querystring parameters and comma separated values,
+// e.g. ["open", "pending", "closed"] for ?status=open,pending&status=closed. Values are trimmed of whitespace
+// and empty values dropped. A path parameter with the key overrides the querystring as a single value.
+func (this *Params) GetStrings(key string) []string {
+	if val, ok := this.o[key]; ok {
+		return []string{val}
+	}
+	if this.p != nil {
+		if val := this.p.ByName(key); val != "" {
+			return []string{val}
+		}
+	}
+	var vals []string
+	for _, param := range this.query()[key] {
+		for _, val := range strings.Split(param, ",") {
+			if val = strings.TrimSpace(val); val != "" {
+				vals = append(vals, val)
+			}
+		}
+	}
+	return vals
+}
+
+// GetInts returns the given key's values as ints, like GetStrings, e.g. for lists of IDs.
+// Returns nil for missing keys, and an error if any of the values is invalid.
+func (this *Params) GetInts(key string) ([]int, error) {
+	strVals := this.GetStrings(key)
+	if len(strVals) == 0 {
+		return nil, nil
+	}
+	vals := make([]int, len(strVals))
+	for i, strVal := range strVals {
+		val, err := strconv.Atoi(strVal)
+		if err != nil {
+			return nil, err
 		}
+		vals[i] = val
 	}
-	return 0
+	return vals, nil
 }
 
-// GetInt64 returns the given key's value as an int64.
+// GetEnum returns the given key's value if it's one of the allowed values, matched case-insensitively and returned
+// in the casing of the allowed value. Returns ErrParamMissing for missing values and a ValidationError with
+// ErrCodeInvalidState, with the allowed values as data, for other values.
+func (this *Params) GetEnum(key string, allowed ...string) (string, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return "", ErrParamMissing
+	}
+	for _, val := range allowed {
+		if strings.EqualFold(strVal, val) {
+			return val, nil
+		}
+	}
+	verr := NewValidationError()
+	verr.AddErrorDetailed(key, ErrCodeInvalidState, allowed, "Expected one of %s", strings.Join(allowed, ", "))
+	return "", verr
+}
+
+// GetEnumDefault is like GetEnum, but returns def if the key is missing or empty, and an empty string for other values.
+func (this *Params) GetEnumDefault(key string, def string, allowed ...string) string {
+	val, err := this.GetEnum(key, allowed...)
+	if err == ErrParamMissing {
+		return def
+	}
+	return val
+}
+
+// GetJSON decodes the given key's JSON value into dst, e.g. for ?filter={"tags":["a"]}, using Unmarshal.
+// Returns ErrParamMissing for missing values, and a ValidationError with ErrCodeValueTooHigh for values longer than
+// the router's MaxJSONParamSize or with ErrCodeSyntaxError for values that can't be decoded.
+func (this *Params) GetJSON(key string, dst interface{}) error {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return ErrParamMissing
+	}
+	verr := NewValidationError()
+	if maxSize := this.maxJSONParamSize(); len(strVal) > maxSize {
+		verr.AddErrorDetailed(key, ErrCodeValueTooHigh, maxSize, "The value must not exceed %d bytes", maxSize)
+		return verr
+	}
+	if err := Unmarshal([]byte(strVal), dst); err != nil {
+		verr.AddErrorDetailed(key, ErrCodeSyntaxError, nil, "%v", err)
+		return verr
+	}
+	return nil
+}
+
+// GetBase64 returns the given key's value decoded as unpadded, URL safe base64 (base64.RawURLEncoding), or
+// as standard, padded base64 (base64.StdEncoding). Returns ErrParamMissing for missing values and an error for
+// invalid values and values decoding to more than the router's MaxBase64ParamSize bytes.
+func (this *Params) GetBase64(key string) ([]byte, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return nil, ErrParamMissing
+	}
+	maxSize := this.maxBase64ParamSize()
+	if base64.RawURLEncoding.DecodedLen(len(strVal)) > maxSize+2 {
+		return nil, fmt.Errorf("milk: parameter %s exceeds %d bytes", key, maxSize)
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strVal)
+	if err != nil {
+		// an unencoded '+' of the standard alphabet is decoded as a space in querystrings
+		if b, err = base64.StdEncoding.DecodeString(strings.Replace(strVal, " ", "+", -1)); err != nil {
+			if strings.Contains(strVal, "=") {
+				return nil, fmt.Errorf("milk: parameter %s has invalid base64 padding: %v", key, err)
+			}
+			return nil, fmt.Errorf("milk: parameter %s is not valid base64: %v", key, err)
+		}
+	}
+	if len(b) > maxSize {
+		return nil, fmt.Errorf("milk: parameter %s exceeds %d bytes", key, maxSize)
+	}
+	return b, nil
+}
+
+// GetPath returns the given key's value as a cleaned, slash separated path without leading or trailing slashes.
+// It is intended for catch-all parameters, e.g. the filepath parameter of a route registered as "/files/*filepath".
+// Returns an empty string for paths containing ".." segments.
+func (this *Params) GetPath(key string) string {
+	val := strings.Replace(this.Get(key), "\\", "/", -1)
+	for _, segment := range strings.Split(val, "/") {
+		if segment == ".." {
+			return ""
+		}
+	}
+	return strings.Trim(path.Clean("/"+val), "/")
+}
+
+// GetDuration returns the given key's value as a time.Duration, parsed by time.ParseDuration, e.g. ?window=15m
+// or ?ttl=2h30m. Bare integers are in the router's DurationUnit.
 // Returns 0 for invalid or missing values.
 // The request path is searched first and overrides any querystring values with the same key.
-func (this *Params) GetInt64(key string) int64 {
-	var val int64
-	if strVal := this.Get(key); strVal != "" {
-		if intVal, err := strconv.ParseInt(strVal, 10, 64); err == nil {
-			val = intVal
+func (this *Params) GetDuration(key string) time.Duration {
+	val, _ := this.GetDurationE(key)
+	return val
+}
+
+// GetDurationE is like GetDuration, but returns ErrParamMissing for missing values and the parse error for invalid
+// values, e.g. for responding with a ValidationError with ErrCodeSyntaxError.
+func (this *Params) GetDurationE(key string) (time.Duration, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return 0, ErrParamMissing
+	}
+	if unit := this.durationUnit(); unit > 0 {
+		if n, err := strconv.ParseInt(strVal, 10, 64); err == nil {
+			if d := time.Duration(n) * unit; d/unit == time.Duration(n) {
+				return d, nil
+			}
+			return 0, fmt.Errorf("milk: parameter %s is out of range", key)
 		}
 	}
+	return time.ParseDuration(strVal)
+}
+
+// GetUUID returns the given key's value as a UUID in the lower case, hyphenated form of RFC 4122, e.g.
+// 6ba7b810-9dad-11d1-80b4-00c04fd430c8. Upper case values are accepted, as are values without hyphens unless
+// the router sets UUIDHyphensRequired.
+// Returns ErrParamMissing for missing values and an error for invalid values.
+// The request path is searched first and overrides any querystring values with the same key.
+func (this *Params) GetUUID(key string) (string, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return "", ErrParamMissing
+	}
+	if len(strVal) == 36 && strVal[8] == '-' && strVal[13] == '-' && strVal[18] == '-' && strVal[23] == '-' {
+		strVal = strVal[:8] + strVal[9:13] + strVal[14:18] + strVal[19:23] + strVal[24:]
+	} else if len(strVal) != 32 || (this.router != nil && this.router.uuidHyphensRequired()) {
+		return "", fmt.Errorf("milk: parameter %s is not a valid UUID", key)
+	}
+	b, err := hex.DecodeString(strVal)
+	if err != nil {
+		return "", fmt.Errorf("milk: parameter %s is not a valid UUID", key)
+	}
+	h := hex.EncodeToString(b)
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// RequireUUID is like GetUUID, but adds an error with ErrCodeRequired or ErrCodeSyntaxError to verr and returns an
+// empty string for missing or invalid values.
+//
+//	verr := milk.NewValidationError()
+//	id := c.Params.RequireUUID("id", verr)
+//	if verr.HasErrors() {
+//		return verr
+//	}
+func (this *Params) RequireUUID(key string, verr *ValidationError) string {
+	val, err := this.GetUUID(key)
+	if err == ErrParamMissing {
+		verr.AddError(key, ErrCodeRequired)
+	} else if err != nil {
+		verr.AddError(key, ErrCodeSyntaxError)
+	}
 	return val
 }
 
-// GetDate returns the given key's value as a time.Time instance, parsed by the format set
-// in the DateFormat variable.
+// GetTimeIn is like GetTimeE, but parses values without a time zone offset, like ?date=2024-06-01, in the
+// location named by the tzKey value, e.g. &tz=Europe/Oslo, or in the router's Location if tzKey is missing.
+// Unknown location names result in a ValidationError with ErrCodeSyntaxError for tzKey.
+func (this *Params) GetTimeIn(key, tzKey string) (time.Time, error) {
+	loc := time.UTC
+	if this.router != nil {
+		loc = this.router.location()
+	}
+	if tz := this.Get(tzKey); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			verr := NewValidationError()
+			verr.AddErrorDetailed(tzKey, ErrCodeSyntaxError, nil, "Unknown time zone %s", tz)
+			return time.Time{}, verr
+		}
+	}
+	return this.parseTime(key, loc, nil)
+}
+
+// query returns the parsed querystring of the request, parsing it on the first call.
+func (this *Params) query() url.Values {
+	if this.q == nil {
+		this.q = this.r.URL.Query()
+	}
+	return this.q
+}
+
+func (this *Params) durationUnit() time.Duration {
+	if this.router != nil {
+		return this.router.durationUnit()
+	}
+	return DefaultDurationUnit
+}
+
+func (this *Params) maxJSONParamSize() int {
+	if this.router != nil {
+		return this.router.maxJSONParamSize()
+	}
+	return DefaultMaxJSONParamSize
+}
+
+func (this *Params) maxBase64ParamSize() int {
+	if this.router != nil {
+		return this.router.maxBase64ParamSize()
+	}
+	return DefaultMaxBase64ParamSize
+}
+
+// Bind maps the path parameters and querystring values of the request onto the fields of dst, a pointer to
+// a struct, by the fields' `param:"name"` tags. Path parameters override querystring values with the same key.
+// Values are converted as by Context.BindQuery, and fields tagged as required, like `param:"id,required"`,
+// result in an error with ErrCodeRequired if missing. The fields of struct fields are bound with a prefix:
+//
+//	type Search struct {
+//		Query string `param:"q,required"`
+//		Page  struct {
+//			Limit  int `param:"limit"`  // ?page.limit=20
+//			Offset int `param:"offset"` // ?page.offset=40
+//		} `param:"page"`
+//	}
+//
+// Errors for all fields are combined into a single ValidationError.
+func (this *Params) Bind(dst interface{}) error {
+	return bind(dst, "param", false, this.layouts(), func(key string) []string {
+		if val, ok := this.o[key]; ok {
+			return []string{val}
+		}
+		if this.p != nil {
+			if val := this.p.ByName(key); val != "" {
+				return []string{val}
+			}
+		}
+		return this.query()[key]
+	})
+}
+
+// All returns a snapshot of all the request path parameters and querystring values. Path parameters override any
+// querystring values with the same key. Modifying the returned map doesn't affect the Params.
+func (this *Params) All() map[string][]string {
+	all := make(map[string][]string)
+	for key, vals := range this.query() {
+		all[key] = append([]string(nil), vals...)
+	}
+	names, values := listPathParams(this.p)
+	for i, name := range names {
+		all[name] = []string{values[i]}
+	}
+	for key, val := range this.o {
+		all[key] = []string{val}
+	}
+	return all
+}
+
+// GetDate returns the given key's value as a time.Time instance, parsed by the first of the router's
+// DateFormats that matches the value, or by the format set in the DateFormat variable.
 // Returns the zero value for invalid or missing values.
 // The request path is searched first and overrides any querystring values with the same key.
 func (this *Params) GetDate(key string) time.Time {
-	t, _ := time.Parse(DateFormat, this.Get(key))
+	t, _ := this.GetDateE(key)
+	return t
+}
+
+// GetDateE is like GetDate, but returns ErrParamMissing for missing values and the parse error of the
+// last format tried for invalid values.
+func (this *Params) GetDateE(key string) (time.Time, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return time.Time{}, ErrParamMissing
+	}
+	var err error
+	for _, layout := range this.layouts() {
+		var t time.Time
+		if t, err = time.Parse(layout, strVal); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// Require returns a ValidationError with ErrCodeRequired for each of the keys missing a value,
+// or nil if they all have one.
+//
+//	if verr := c.Params.Require("from", "to"); verr != nil {
+//		return verr
+//	}
+func (this *Params) Require(keys ...string) *ValidationError {
+	verr := NewValidationError()
+	for _, key := range keys {
+		if this.Get(key) == "" {
+			verr.AddError(key, ErrCodeRequired)
+		}
+	}
+	if verr.HasErrors() {
+		return verr
+	}
+	return nil
+}
+
+// RangeOpts configures the date range read by Params.DateRange.
+type RangeOpts struct {
+	DefaultFrom time.Time // Start of the range when the from parameter is missing. Required if zero.
+	DefaultTo   time.Time // End of the range when the to parameter is missing, e.g. today. Required if zero.
+	MaxDays     int       // Maximum number of days in the range, counting both ends. No maximum if 0.
+
+	// EndExclusive makes DateRange return the day after the to parameter as the end of the range,
+	// for half-open queries like date >= from && date < to. The to parameter itself is always inclusive.
+	EndExclusive bool
+}
+
+// DateRange returns the start and end of the date range in the given keys' values, parsed as by GetDate, e.g.
+// ?from=2024-01-01&to=2024-01-31. Missing values get the defaults of opts. Invalid and missing values without
+// defaults result in a ValidationError with ErrCodeSyntaxError or ErrCodeRequired, a to date before the from date in
+// one with ErrCodeValueTooLow and ranges longer than opts.MaxDays in one with ErrCodeValueTooHigh, keyed by toKey.
+func (this *Params) DateRange(fromKey, toKey string, opts RangeOpts) (time.Time, time.Time, *ValidationError) {
+	verr := NewValidationError()
+	from := this.rangeDate(fromKey, opts.DefaultFrom, verr)
+	to := this.rangeDate(toKey, opts.DefaultTo, verr)
+	if verr.HasErrors() {
+		return time.Time{}, time.Time{}, verr
+	}
+	if to.Before(from) {
+		verr.AddErrorDetailed(toKey, ErrCodeValueTooLow, from.Format(this.layouts()[0]), "%s must not be before %s", toKey, fromKey)
+	} else if opts.MaxDays > 0 && to.Sub(from) >= time.Duration(opts.MaxDays)*24*time.Hour {
+		verr.AddErrorDetailed(toKey, ErrCodeValueTooHigh, opts.MaxDays, "The range must not exceed %d days", opts.MaxDays)
+	}
+	if verr.HasErrors() {
+		return time.Time{}, time.Time{}, verr
+	}
+	if opts.EndExclusive {
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// rangeDate returns the given key's date, or def if it's missing, adding an error to verr if it's invalid,
+// or missing without a default.
+func (this *Params) rangeDate(key string, def time.Time, verr *ValidationError) time.Time {
+	t, err := this.GetDateE(key)
+	if err == ErrParamMissing && !def.IsZero() {
+		return def
+	} else if err == ErrParamMissing {
+		verr.AddError(key, ErrCodeRequired)
+	} else if err != nil {
+		verr.AddError(key, ErrCodeSyntaxError)
+	}
 	return t
 }
@@ -0,0 +1,599 @@
+package milk
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// paramTest reads a param of a request to route with read.
+type paramTest struct {
+	name  string
+	route string // route defaults to "/x"
+	url   string
+	setup func(r *Router)
+	read  func(p *Params) (interface{}, error)
+	want  string // want is the value read, formatted by fmt.Sprint
+	err   error  // err is the expected error, or errAny for any error
+}
+
+// testParams serves the requests of tests, checking the values and errors read.
+func testParams(t *testing.T, tests []paramTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			if test.setup != nil {
+				test.setup(r)
+			}
+			route := test.route
+			if route == "" {
+				route = "/x"
+			}
+			var got interface{}
+			var err error
+			r.Get(route, func(c *Context) error {
+				got, err = test.read(c.Params)
+				return nil
+			})
+			if w := serveRequest(r, "GET", test.url, nil); w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if test.err == errAny && err == nil || test.err != errAny && err != test.err {
+				t.Errorf("expected error %v, got %v", test.err, err)
+			}
+			if s := fmt.Sprint(got); s != test.want {
+				t.Errorf("expected %s, got %s", test.want, s)
+			}
+		})
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	testParams(t, []paramTest{
+		{name: "path", route: "/files/*path", url: "/files/a/b/c.txt", read: getPath("path"), want: "a/b/c.txt"},
+		{name: "path cleaned", route: "/files/*path", url: "/files/a//b/./c/", read: getPath("path"), want: "a/b/c"},
+		{name: "path traversal", route: "/files/*path", url: "/files/a/../../etc/passwd", read: getPath("path"), want: ""},
+		{name: "encoded path traversal", route: "/files/*path", url: "/files/a/%2e%2e/b", read: getPath("path"), want: ""},
+		{name: "backslash path traversal", route: "/files/*path", url: `/files/a\..\b`, read: getPath("path"), want: ""},
+		{name: "dots in names", route: "/files/*path", url: "/files/a/..b/c..", read: getPath("path"), want: "a/..b/c.."},
+		{name: "empty path", route: "/files/*path", url: "/files/", read: getPath("path"), want: ""},
+	})
+}
+
+func TestGetFloat64(t *testing.T) {
+	testParams(t, []paramTest{
+		{name: "float", url: "/x?f=1.25", read: func(p *Params) (interface{}, error) { return p.GetFloat64E("f") }, want: "1.25"},
+		{name: "float exponent", url: "/x?f=1.5e3", read: func(p *Params) (interface{}, error) { return p.GetFloat64E("f") }, want: "1500"},
+		{name: "float nan", url: "/x?f=NaN", read: func(p *Params) (interface{}, error) { return p.GetFloat64E("f") }, want: "0", err: errAny},
+		{name: "float infinity", url: "/x?f=-Inf", read: func(p *Params) (interface{}, error) { return p.GetFloat64("f"), nil }, want: "0"},
+		{name: "float invalid", url: "/x?f=x", read: func(p *Params) (interface{}, error) { return p.GetFloat64E("f") }, want: "0", err: errAny},
+		{name: "float missing", url: "/x", read: func(p *Params) (interface{}, error) { return p.GetFloat64E("f") }, want: "0", err: ErrParamMissing},
+	})
+}
+
+func TestGetBool(t *testing.T) {
+	testParams(t, []paramTest{
+		{name: "bool true", url: "/x?b=TRUE", read: getBool("b", false), want: "true"},
+		{name: "bool false", url: "/x?b=0", read: getBool("b", true), want: "false"},
+		{name: "bool without value", url: "/x?b", read: getBool("b", false), want: "true"},
+		{name: "bool invalid", url: "/x?b=yes", read: getBool("b", true), want: "false"},
+		{name: "bool missing", url: "/x", read: getBool("b", true), want: "true"},
+	})
+}
+
+func TestGetTime(t *testing.T) {
+	testParams(t, []paramTest{
+		{
+			name: "time with layout", url: "/x?t=01/06/2021",
+			read: getTime("t", "02/01/2006"), want: "2021-06-01T00:00:00Z",
+		},
+		{
+			name: "time falling back to RFC 3339", url: "/x?t=2021-06-01T10:00:00+02:00",
+			read: getTime("t", "02/01/2006"), want: "2021-06-01T10:00:00+02:00",
+		},
+		{
+			name: "time falling back to the date formats", url: "/x?t=2021-06-01",
+			read: getTime("t", "02/01/2006"), want: "2021-06-01T00:00:00Z",
+		},
+		{
+			name: "time with a space in the layout", url: "/x?t=2021-06-01+10:00",
+			read: getTime("t", "2006-01-02 15:04"), want: "2021-06-01T10:00:00Z",
+		},
+		{
+			name: "time with spaces and a comma in the layout", url: "/x?t=Jun%201,%202021",
+			read: getTime("t", "Jan 2, 2006"), want: "2021-06-01T00:00:00Z",
+		},
+		{
+			name: "time in the HTTP format", url: "/x?t=" + url.QueryEscape("Tue, 01 Jun 2021 10:00:00 GMT"),
+			read: getTime("t", http.TimeFormat), want: "2021-06-01T10:00:00Z",
+		},
+		{name: "time invalid", url: "/x?t=yesterday", read: getTime("t"), want: "0001-01-01T00:00:00Z", err: errAny},
+	})
+}
+
+func TestErrorAccessors(t *testing.T) {
+	testParams(t, []paramTest{
+		{name: "int", route: "/x/:n", url: "/x/42", read: func(p *Params) (interface{}, error) { return p.GetIntE("n") }, want: "42"},
+		{name: "int invalid", url: "/x?n=4x", read: func(p *Params) (interface{}, error) { return p.GetIntE("n") }, want: "0", err: errAny},
+		{name: "int missing", url: "/x?n=", read: func(p *Params) (interface{}, error) { return p.GetIntE("n") }, want: "0", err: ErrParamMissing},
+		{
+			name: "int64", url: "/x?n=9007199254740993",
+			read: func(p *Params) (interface{}, error) { return p.GetInt64E("n") }, want: "9007199254740993",
+		},
+		{
+			name: "int64 overflowing", url: "/x?n=9223372036854775808",
+			read: func(p *Params) (interface{}, error) { return p.GetInt64E("n") }, want: "0", err: errAny,
+		},
+		{
+			name: "date", url: "/x?d=2021-06-01",
+			read: func(p *Params) (interface{}, error) { d, err := p.GetDateE("d"); return d.Format(time.RFC3339), err },
+			want: "2021-06-01T00:00:00Z",
+		},
+		{
+			name: "date invalid", url: "/x?d=01.06.2021",
+			read: func(p *Params) (interface{}, error) { _, err := p.GetDateE("d"); return nil, err }, want: "<nil>", err: errAny,
+		},
+	})
+}
+
+func TestDefaultAccessors(t *testing.T) {
+	testParams(t, []paramTest{
+		{name: "int default", url: "/x", read: func(p *Params) (interface{}, error) { return p.GetIntDefault("n", 20), nil }, want: "20"},
+		{name: "int default zero", url: "/x?n=0", read: func(p *Params) (interface{}, error) { return p.GetIntDefault("n", 20), nil }, want: "0"},
+		{name: "int default invalid", url: "/x?n=x", read: func(p *Params) (interface{}, error) { return p.GetIntDefault("n", 20), nil }, want: "0"},
+		{name: "int64 default", url: "/x?n=", read: func(p *Params) (interface{}, error) { return p.GetInt64Default("n", 7), nil }, want: "7"},
+		{name: "string default", url: "/x?s=", read: func(p *Params) (interface{}, error) { return p.GetStringDefault("s", "d"), nil }, want: "d"},
+		{name: "string value", url: "/x?s=v", read: func(p *Params) (interface{}, error) { return p.GetStringDefault("s", "d"), nil }, want: "v"},
+	})
+}
+
+func TestGetStrings(t *testing.T) {
+	testParams(t, []paramTest{
+		{
+			name: "strings", url: "/x?s=a,b&s=c,%20,d",
+			read: func(p *Params) (interface{}, error) { return p.GetStrings("s"), nil }, want: "[a b c d]",
+		},
+		{
+			name: "strings from path", route: "/x/:s", url: "/x/a,b?s=c",
+			read: func(p *Params) (interface{}, error) { return p.GetStrings("s"), nil }, want: "[a,b]",
+		},
+		{name: "strings missing", url: "/x", read: func(p *Params) (interface{}, error) { return p.GetStrings("s"), nil }, want: "[]"},
+		{name: "ints", url: "/x?id=1,2&id=3", read: func(p *Params) (interface{}, error) { return p.GetInts("id") }, want: "[1 2 3]"},
+		{name: "ints invalid", url: "/x?id=1,x", read: func(p *Params) (interface{}, error) { return p.GetInts("id") }, want: "[]", err: errAny},
+	})
+}
+
+func TestHasAndAll(t *testing.T) {
+	testParams(t, []paramTest{
+		{name: "has without value", url: "/x?q=&flag", read: func(p *Params) (interface{}, error) { return p.Has("q") && p.Has("flag"), nil }, want: "true"},
+		{name: "has missing", url: "/x?q=", read: func(p *Params) (interface{}, error) { return p.Has("other"), nil }, want: "false"},
+		{
+			name: "all", route: "/x/:id", url: "/x/1?id=2&tag=a&tag=b",
+			read: func(p *Params) (interface{}, error) {
+				all := p.All()
+				all["tag"][0] = "changed"
+				return fmt.Sprint(all, p.GetStrings("tag")), nil
+			},
+			want: "map[id:[1] tag:[changed b]] [a b]",
+		},
+		{
+			name: "all with override", url: "/x?id=2",
+			read: func(p *Params) (interface{}, error) { p.Override("id", "3"); return p.All(), nil }, want: "map[id:[3]]",
+		},
+	})
+}
+
+func TestGetUUID(t *testing.T) {
+	testParams(t, []paramTest{
+		{
+			name: "uuid upper case", url: "/x?id=6BA7B810-9DAD-11D1-80B4-00C04FD430C8",
+			read: func(p *Params) (interface{}, error) { return p.GetUUID("id") }, want: "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		},
+		{
+			name: "nil uuid", url: "/x?id=00000000-0000-0000-0000-000000000000",
+			read: func(p *Params) (interface{}, error) { return p.GetUUID("id") }, want: "00000000-0000-0000-0000-000000000000",
+		},
+		{
+			name: "uuid with misplaced hyphens", url: "/x?id=6ba7b8109-dad-11d1-80b4-00c04fd430c8",
+			read: func(p *Params) (interface{}, error) { return p.GetUUID("id") }, want: "", err: errAny,
+		},
+		{
+			name: "uuid not hex", url: "/x?id=zba7b810-9dad-11d1-80b4-00c04fd430c8",
+			read: func(p *Params) (interface{}, error) { return p.GetUUID("id") }, want: "", err: errAny,
+		},
+		{name: "required uuid", url: "/x?b=x", read: requireUUIDs("a", "b"), want: "a required,b syntax-error"},
+	})
+}
+
+func TestGetTimeIn(t *testing.T) {
+	oslo, err := time.LoadLocation("Europe/Oslo")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	testParams(t, []paramTest{
+		{
+			name: "date in time zone", url: "/x?d=2024-06-01&tz=Europe/Oslo",
+			read: getTimeIn("d", "tz"), want: "2024-05-31T22:00:00Z",
+		},
+		{
+			name: "date in time zone after the end of daylight saving time", url: "/x?d=2024-10-28&tz=Europe/Oslo",
+			read: getTimeIn("d", "tz"), want: "2024-10-27T23:00:00Z",
+		},
+		{
+			name: "date on the day daylight saving time ends", url: "/x?d=2024-10-27&tz=Europe/Oslo",
+			read: getTimeIn("d", "tz"), want: "2024-10-26T22:00:00Z",
+		},
+		{
+			name: "date in the router's location", url: "/x?d=2024-01-01",
+			setup: func(r *Router) { r.Location = oslo },
+			read:  getTimeIn("d", "tz"), want: "2023-12-31T23:00:00Z",
+		},
+		{
+			name: "time with offset", url: "/x?d=2024-01-01T00:00:00Z&tz=Europe/Oslo",
+			read: getTimeIn("d", "tz"), want: "2024-01-01T00:00:00Z",
+		},
+		{
+			name: "unknown time zone", url: "/x?d=2024-01-01&tz=Mars/Olympus",
+			read: getTimeIn("d", "tz"), want: "0001-01-01T00:00:00Z", err: errAny,
+		},
+	})
+}
+
+func TestGetEnum(t *testing.T) {
+	testParams(t, []paramTest{
+		{
+			name: "enum", url: "/x?sort=NAME",
+			read: func(p *Params) (interface{}, error) { return p.GetEnum("sort", "name", "date") }, want: "name",
+		},
+		{
+			name: "enum not allowed", url: "/x?sort=size",
+			read: func(p *Params) (interface{}, error) { return p.GetEnum("sort", "name", "date") }, want: "", err: errAny,
+		},
+		{
+			name: "enum missing", url: "/x",
+			read: func(p *Params) (interface{}, error) { return p.GetEnum("sort", "name") }, want: "", err: ErrParamMissing,
+		},
+		{
+			name: "enum default", url: "/x",
+			read: func(p *Params) (interface{}, error) { return p.GetEnumDefault("sort", "date", "name", "date"), nil }, want: "date",
+		},
+		{
+			name: "enum default not allowed", url: "/x?sort=size",
+			read: func(p *Params) (interface{}, error) { return p.GetEnumDefault("sort", "date", "name", "date"), nil }, want: "",
+		},
+	})
+}
+
+func TestGetJSON(t *testing.T) {
+	testParams(t, []paramTest{
+		{
+			name: "json nested", url: "/x?f=" + url.QueryEscape(`{"tags":["a"],"range":{"min":1}}`),
+			read: getJSON("f"), want: "map[range:map[min:1] tags:[a]]",
+		},
+		{name: "json malformed", url: "/x?f=" + url.QueryEscape(`{"tags":`), read: getJSON("f"), want: "map[]", err: errAny},
+		{name: "json missing", url: "/x", read: getJSON("f"), want: "map[]", err: ErrParamMissing},
+	})
+}
+
+func TestGetBase64(t *testing.T) {
+	testParams(t, []paramTest{
+		{name: "base64 url safe", url: "/x?b=-_8", read: getBase64("b"), want: "fbff"},
+		{name: "base64 standard", url: "/x?b=" + url.QueryEscape("+/8="), read: getBase64("b"), want: "fbff"},
+		{name: "base64 standard with unencoded plus", url: "/x?b=+/8=", read: getBase64("b"), want: "fbff"},
+		{name: "base64 padded", url: "/x?b=YWI%3D", read: getBase64("b"), want: "6162"},
+		{name: "base64 bad padding", url: "/x?b=YW%3DI", read: getBase64("b"), want: "", err: errAny},
+		{name: "base64 invalid", url: "/x?b=*", read: getBase64("b"), want: "", err: errAny},
+	})
+}
+
+// errAny is expected by tests accepting any error.
+var errAny = errors.New("any error")
+
+func getPath(key string) func(p *Params) (interface{}, error) {
+	return func(p *Params) (interface{}, error) { return p.GetPath(key), nil }
+}
+
+func getBool(key string, def bool) func(p *Params) (interface{}, error) {
+	return func(p *Params) (interface{}, error) { return p.GetBoolDefault(key, def), nil }
+}
+
+func getTime(key string, layouts ...string) func(p *Params) (interface{}, error) {
+	return func(p *Params) (interface{}, error) {
+		t, err := p.GetTimeE(key, layouts...)
+		return t.Format(time.RFC3339), err
+	}
+}
+
+func getTimeIn(key, tzKey string) func(p *Params) (interface{}, error) {
+	return func(p *Params) (interface{}, error) {
+		t, err := p.GetTimeIn(key, tzKey)
+		return t.UTC().Format(time.RFC3339), err
+	}
+}
+
+func getJSON(key string) func(p *Params) (interface{}, error) {
+	return func(p *Params) (interface{}, error) {
+		dst := map[string]interface{}{}
+		err := p.GetJSON(key, &dst)
+		return dst, err
+	}
+}
+
+func getBase64(key string) func(p *Params) (interface{}, error) {
+	return func(p *Params) (interface{}, error) {
+		b, err := p.GetBase64(key)
+		return hex.EncodeToString(b), err
+	}
+}
+
+func requireUUIDs(keys ...string) func(p *Params) (interface{}, error) {
+	return func(p *Params) (interface{}, error) {
+		verr := NewValidationError()
+		for _, key := range keys {
+			p.RequireUUID(key, verr)
+		}
+		var errs []string
+		for _, e := range verr.Errors {
+			errs = append(errs, e.FieldName+" "+e.ErrorCode)
+		}
+		return strings.Join(errs, ","), nil
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	tests := []struct {
+		name   string
+		url    string
+		opts   RangeOpts
+		from   string
+		to     string
+		errors []string
+	}{
+		{name: "range", url: "/x?from=2024-01-01&to=2024-01-31", from: "2024-01-01", to: "2024-01-31"},
+		{name: "single day", url: "/x?from=2024-01-01&to=2024-01-01", from: "2024-01-01", to: "2024-01-01"},
+		{
+			name: "end exclusive", url: "/x?from=2024-01-01&to=2024-01-31", opts: RangeOpts{EndExclusive: true},
+			from: "2024-01-01", to: "2024-02-01",
+		},
+		{
+			name: "defaults", url: "/x", opts: RangeOpts{DefaultFrom: day("2024-01-01"), DefaultTo: day("2024-01-07")},
+			from: "2024-01-01", to: "2024-01-07",
+		},
+		{name: "missing without defaults", url: "/x?to=2024-01-01", errors: []string{"from required"}},
+		{name: "invalid", url: "/x?from=x&to=2024-13-01", errors: []string{"from syntax-error", "to syntax-error"}},
+		{name: "reversed", url: "/x?from=2024-01-02&to=2024-01-01", errors: []string{"to value-too-low"}},
+		{name: "within max days", url: "/x?from=2024-01-01&to=2024-01-07", opts: RangeOpts{MaxDays: 7}, from: "2024-01-01", to: "2024-01-07"},
+		{name: "exceeding max days", url: "/x?from=2024-01-01&to=2024-01-08", opts: RangeOpts{MaxDays: 7}, errors: []string{"to value-too-high"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var from, to time.Time
+			var verr *ValidationError
+			r.Get("/x", func(c *Context) error {
+				from, to, verr = c.Params.DateRange("from", "to", test.opts)
+				return nil
+			})
+			serveRequest(r, "GET", test.url, nil)
+			var errs []string
+			if verr != nil {
+				for _, e := range verr.Errors {
+					errs = append(errs, e.FieldName+" "+e.ErrorCode)
+				}
+			}
+			if strings.Join(errs, ",") != strings.Join(test.errors, ",") {
+				t.Fatalf("expected errors %q, got %q", test.errors, errs)
+			}
+			if test.errors == nil && (from.Format("2006-01-02") != test.from || to.Format("2006-01-02") != test.to) {
+				t.Errorf("expected %s to %s, got %s to %s", test.from, test.to, from, to)
+			}
+		})
+	}
+}
+
+// TestQueryCachePerRequest checks that the parsed querystring cached by Params isn't shared by the requests
+// reusing a pooled context.
+func TestQueryCachePerRequest(t *testing.T) {
+	r, _ := newTestRouter()
+	r.Get("/x", func(c *Context) error {
+		c.Result = c.Params.Get("a") + c.Params.GetStringDefault("b", "-")
+		return nil
+	})
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "/x?a=1&b=2", want: "12"},
+		{url: "/x?a=3", want: "3-"},
+		{url: "/x", want: "-"},
+		{url: "/x?b=4", want: "4"},
+	}
+	for i := 0; i < 10; i++ {
+		for _, test := range tests {
+			w := serveRequest(r, "GET", test.url, nil)
+			if got := strings.TrimSpace(w.Body.String()); got != `"`+test.want+`"` {
+				t.Fatalf("%s: expected %q, got %s", test.url, test.want, got)
+			}
+		}
+	}
+}
+
+// BenchmarkParams measures the allocations of a handler reading eight params, comparing the cached querystring
+// of Params with parsing it for every read.
+func BenchmarkParams(b *testing.B) {
+	keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	reads := map[string]func(c *Context, key string) string{
+		"cached":   func(c *Context, key string) string { return c.Params.Get(key) },
+		"reparsed": func(c *Context, key string) string { return c.R.URL.Query().Get(key) },
+	}
+	for _, name := range []string{"cached", "reparsed"} {
+		read := reads[name]
+		b.Run(name, func(b *testing.B) {
+			r := NewRouter()
+			r.Get("/x", func(c *Context) error {
+				for _, key := range keys {
+					read(c, key)
+				}
+				return nil
+			})
+			req := httptest.NewRequest("GET", "/x?a=1&b=2&c=3&d=4&e=5&f=6&g=7&h=8", nil)
+			w := &countingResponseWriter{}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w.header = nil
+				r.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+// paramSettingTest reads a param of a request to the sub-router of a root router with read, after setup has
+// applied the settings of the routers.
+type paramSettingTest struct {
+	name  string
+	setup func(root, sub *Router)
+	url   string
+	read  func(p *Params) (interface{}, error)
+	want  interface{}
+	fail  bool
+}
+
+// testParamSettings serves the requests of tests, checking the values read.
+func testParamSettings(t *testing.T, tests []paramSettingTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, _ := newTestRouter()
+			sub := root.SubRouter("/sub")
+			if test.setup != nil {
+				test.setup(root, sub)
+			}
+			var got interface{}
+			var err error
+			sub.Get("", func(c *Context) error {
+				got, err = test.read(c.Params)
+				return nil
+			})
+			if w := serveRequest(root, "GET", strings.Replace(test.url, "[", "%5B", -1), nil); w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if test.fail {
+				if err == nil {
+					t.Errorf("expected an error, got %v", got)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			} else if test.want != nil && got != test.want {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestDurationUnitSetting(t *testing.T) {
+	testParamSettings(t, []paramSettingTest{
+		{
+			name: "default duration unit", url: "/sub?d=300",
+			read: func(p *Params) (interface{}, error) { return p.GetDurationE("d") },
+			want: 300 * time.Second,
+		},
+		{
+			name: "inherited duration unit", url: "/sub?d=300",
+			setup: func(root, sub *Router) { root.DurationUnit = time.Millisecond },
+			read:  func(p *Params) (interface{}, error) { return p.GetDurationE("d") },
+			want:  300 * time.Millisecond,
+		},
+		{
+			name: "overridden duration unit", url: "/sub?d=300",
+			setup: func(root, sub *Router) { root.DurationUnit, sub.DurationUnit = time.Millisecond, time.Minute },
+			read:  func(p *Params) (interface{}, error) { return p.GetDurationE("d") },
+			want:  300 * time.Minute,
+		},
+		{
+			name: "negative duration unit rejects bare integers", url: "/sub?d=300",
+			setup: func(root, sub *Router) { sub.DurationUnit = -1 },
+			read:  func(p *Params) (interface{}, error) { return p.GetDurationE("d") },
+			fail:  true,
+		},
+	})
+}
+
+func TestUUIDHyphensSetting(t *testing.T) {
+	const uuid = "6ba7b8109dad11d180b400c04fd430c8"
+	testParamSettings(t, []paramSettingTest{
+		{
+			name: "uuid without hyphens", url: "/sub?id=" + uuid,
+			read: func(p *Params) (interface{}, error) { return p.GetUUID("id") },
+			want: "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		},
+		{
+			name: "inherited uuid hyphens required", url: "/sub?id=" + uuid,
+			setup: func(root, sub *Router) { root.UUIDHyphensRequired = true },
+			read:  func(p *Params) (interface{}, error) { return p.GetUUID("id") },
+			fail:  true,
+		},
+		{
+			name: "uuid hyphens required on other router", url: "/sub?id=" + uuid,
+			setup: func(root, sub *Router) { NewRouter().UUIDHyphensRequired = true },
+			read:  func(p *Params) (interface{}, error) { return p.GetUUID("id") },
+			want:  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		},
+	})
+}
+
+func TestMaxJSONParamSizeSetting(t *testing.T) {
+	testParamSettings(t, []paramSettingTest{
+		{
+			name: "json within inherited max size", url: `/sub?f=[1,2]`,
+			setup: func(root, sub *Router) { root.MaxJSONParamSize = 5 },
+			read: func(p *Params) (interface{}, error) {
+				var f []int
+				return nil, p.GetJSON("f", &f)
+			},
+		},
+		{
+			name: "json exceeding inherited max size", url: `/sub?f=[1,2,3]`,
+			setup: func(root, sub *Router) { root.MaxJSONParamSize = 5 },
+			read: func(p *Params) (interface{}, error) {
+				var f []int
+				return nil, p.GetJSON("f", &f)
+			},
+			fail: true,
+		},
+		{
+			name: "json within overridden max size", url: `/sub?f=[1,2,3]`,
+			setup: func(root, sub *Router) { root.MaxJSONParamSize, sub.MaxJSONParamSize = 5, 10 },
+			read: func(p *Params) (interface{}, error) {
+				var f []int
+				return nil, p.GetJSON("f", &f)
+			},
+		},
+	})
+}
+
+func TestMaxBase64ParamSizeSetting(t *testing.T) {
+	testParamSettings(t, []paramSettingTest{
+		{
+			name: "base64 within max size", url: "/sub?b=YWJj",
+			setup: func(root, sub *Router) { sub.MaxBase64ParamSize = 3 },
+			read:  func(p *Params) (interface{}, error) { b, err := p.GetBase64("b"); return string(b), err },
+			want:  "abc",
+		},
+		{
+			name: "base64 exceeding max size", url: "/sub?b=YWJjZA",
+			setup: func(root, sub *Router) { sub.MaxBase64ParamSize = 3 },
+			read:  func(p *Params) (interface{}, error) { return p.GetBase64("b") },
+			fail:  true,
+		},
+	})
+}
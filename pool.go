@@ -0,0 +1,73 @@
+package milk
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// contextPool holds contexts, along with their response writers, Params and Values, for reuse by later requests.
+var contextPool = sync.Pool{
+	New: func() interface{} {
+		return &Context{
+			rw:     &responseWriter{},
+			params: &Params{},
+			values: &Values{},
+		}
+	},
+}
+
+// newContext returns a context for serving r, reusing a released context if possible.
+func newContext(router *Router, c context.Context, r *http.Request, w http.ResponseWriter, p PathParams, handlers []HandlerFunc) *Context {
+	context := contextPool.Get().(*Context)
+	rw, params, values := context.rw, context.params, context.values
+	*rw = responseWriter{w: w}
+	*params = Params{r: r, p: p, router: router}
+	params.valueSource = valueSource{lookup: params.lookup, dateFormats: router.dateFormats(), plusSpaces: true}
+	values.reset()
+	*context = Context{
+		Context:  c,
+		R:        r,
+		W:        rw,
+		Params:   params,
+		Values:   values,
+		w:        rw,
+		router:   router,
+		handlers: handlers,
+		rw:       rw,
+		params:   params,
+		values:   values,
+	}
+	if method, ok := r.Context().Value(originalMethodKey).(string); ok {
+		context.Values.Set(KeyOriginalMethod, method)
+	}
+	return context
+}
+
+// release returns the context to the pool once its request has been served. Handlers must not retain the
+// context, or its Params and Values, past the request. Contexts whose handlers may still be running after
+// a timeout are left to the garbage collector.
+//
+// In builds with the race detector or the milkdebug build tag, released contexts are marked as recycled, making
+// any use of their response writer panic until newContext resets them for another request. Builds with the
+// milkdebug tag never reuse contexts, so the panic is certain.
+func (this *Context) release() {
+	if this.detached {
+		return
+	}
+	if poolChecks {
+		this.rw.mu.Lock()
+		this.rw.recycled = true
+		this.rw.mu.Unlock()
+	}
+	if poolReuse {
+		contextPool.Put(this)
+	}
+}
+
+// checkRecycled panics if the response writer is used after its context has been released. this.mu must be held.
+func (this *responseWriter) checkRecycled() {
+	if this.recycled {
+		panic("milk: context used after its request was served")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build race && !milkdebug
+
+package milk
+
+// poolChecks marks released contexts as recycled, detecting use of contexts after their request was served
+// until they are reused.
+const poolChecks = true
+
+// poolReuse enables the reuse of released contexts, so the race detector also covers contexts shared by requests.
+const poolReuse = true
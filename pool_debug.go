@@ -0,0 +1,9 @@
+//go:build milkdebug
+
+package milk
+
+// poolChecks marks released contexts as recycled, detecting use of contexts after their request was served.
+const poolChecks = true
+
+// poolReuse disables the reuse of released contexts, so any later use of them is detected.
+const poolReuse = false
@@ -0,0 +1,9 @@
+//go:build !race && !milkdebug
+
+package milk
+
+// poolChecks marks released contexts as recycled, detecting use of contexts after their request was served.
+const poolChecks = false
+
+// poolReuse enables the reuse of released contexts.
+const poolReuse = true
@@ -0,0 +1,104 @@
+package milk
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestContextReuse serves concurrent requests, checking that no state leaks between the requests sharing
+// pooled contexts. Run with -race to check the pooling for data races.
+func TestContextReuse(t *testing.T) {
+	r, _ := newTestRouter()
+	r.Use(func(c *Context) error {
+		if _, ok := c.Values.GetOK("id"); ok {
+			t.Error("expected the values of a previous request to be cleared")
+		}
+		if c.HasErrors() || c.Result != nil || c.ResponseStatus() != 0 {
+			t.Error("expected the state of a previous request to be cleared")
+		}
+		return nil
+	})
+	r.Get("/items/:id", func(c *Context) error {
+		c.Values.Set("id", c.Params.Get("id"))
+		c.Error(fmt.Errorf("non-fatal"))
+		c.SetHeader("X-Query", c.Params.Get("q"))
+		c.Result = c.Values.GetString("id") + " " + c.Params.Get("q")
+		return nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				id, q := strconv.Itoa(i), strconv.Itoa(j)
+				url := "/items/" + id
+				if j%2 == 0 {
+					url += "?q=" + q
+				} else {
+					q = ""
+				}
+				w := serveRequest(r, "GET", url, nil)
+				if want := `"` + id + " " + q + `"`; strings.TrimSpace(w.Body.String()) != want {
+					t.Errorf("expected %s, got %s", want, w.Body)
+				}
+				if w.Header().Get("X-Query") != q {
+					t.Errorf("expected header X-Query %q, got %q", q, w.Header().Get("X-Query"))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestRecycledContext(t *testing.T) {
+	if !poolChecks {
+		t.Skip("contexts are only marked as recycled in builds with the race detector or the milkdebug tag")
+	}
+	tests := []struct {
+		name string
+		use  func(c *Context)
+	}{
+		{name: "write", use: func(c *Context) { c.W.Write([]byte("late")) }},
+		{name: "header", use: func(c *Context) { c.W.Header().Set("X-Late", "1") }},
+		{name: "next", use: func(c *Context) { c.Next() }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var retained *Context
+			r.Get("/x", func(c *Context) error { retained = c; return nil })
+			serveRequest(r, "GET", "/x", nil)
+			defer func() {
+				if v := recover(); v != "milk: context used after its request was served" {
+					t.Errorf("expected a panic for using a recycled context, got %v", v)
+				}
+			}()
+			test.use(retained)
+		})
+	}
+}
+
+// BenchmarkServeHTTP measures the allocations per request. Run it with and without -tags milkdebug, which
+// disables the reuse of contexts, to see the allocations saved by pooling.
+func BenchmarkServeHTTP(b *testing.B) {
+	r := NewRouter()
+	r.NewLogger = func(c *Context) Logger { return &RecordingLogger{} }
+	r.Use(func(c *Context) error { c.Values.Set("user", "ann"); return nil })
+	r.Get("/items/:id", func(c *Context) error {
+		c.Result = c.Params.GetInt("id")
+		return nil
+	})
+	req := httptest.NewRequest("GET", "/items/42", nil)
+	w := &countingResponseWriter{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.header = nil
+		r.ServeHTTP(w, req)
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/snechholt/milk/protobuf
+
+go 1.20
+
+require (
+	github.com/snechholt/milk v0.0.0-00010101000000-000000000000
+	google.golang.org/protobuf v1.34.2
+)
+
+require github.com/julienschmidt/httprouter v1.3.0 // indirect
+
+replace github.com/snechholt/milk => ../
@@ -0,0 +1,72 @@
+// Package protobuf encodes the responses and decodes the request bodies of milk routers as Protocol Buffers.
+// It's a separate module, so milk itself remains free of dependencies on encoding libraries.
+//
+//	r := milk.NewRouter()
+//	protobuf.Register(r)
+//
+// Results and ParseBody destinations implementing proto.Message are encoded and decoded with proto.Marshal and
+// proto.Unmarshal for requests accepting and sending ContentType. Error payloads are sent as the Error message.
+// Other results fall back to JSON, and other destinations reject the request with milk.ErrUnsupportedMediaType.
+package protobuf
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative error.proto internal/testpb/item.proto
+
+import (
+	"encoding/json"
+
+	"github.com/snechholt/milk"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContentType is the content type of Protocol Buffers requests and responses.
+const ContentType = "application/x-protobuf"
+
+// Register registers the Protocol Buffers encoding for ContentType on the router and its sub-routers.
+func Register(r *milk.Router) {
+	r.RegisterCodec(ContentType, Marshal, Unmarshal)
+}
+
+// Marshal encodes v with proto.Marshal if it's a proto.Message, or as the Error message if it's an error payload.
+// Returns milk.ErrUnsupportedType for other values.
+func Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Marshal(m)
+	} else if payload, fieldErrors, ok := milk.ErrorPayload(v); ok {
+		m, err := newError(payload, fieldErrors)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(m)
+	}
+	return nil, milk.ErrUnsupportedType
+}
+
+// Unmarshal decodes data into v with proto.Unmarshal if v is a proto.Message.
+// Returns milk.ErrUnsupportedType for other values.
+func Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	return milk.ErrUnsupportedType
+}
+
+// newError converts an error payload to the Error message, encoding the data of field errors as JSON.
+func newError(payload *milk.Error, fieldErrors []*milk.FieldError) (*Error, error) {
+	m := &Error{
+		StatusCode: int32(payload.StatusCode),
+		ErrorCode:  payload.ErrorCode,
+		Message:    payload.Message,
+	}
+	for _, e := range fieldErrors {
+		fe := &FieldError{Key: e.FieldName, ErrorCode: e.ErrorCode, Message: e.Message}
+		if e.Data != nil {
+			b, err := json.Marshal(e.Data)
+			if err != nil {
+				return nil, err
+			}
+			fe.Data = string(b)
+		}
+		m.Errors = append(m.Errors, fe)
+	}
+	return m, nil
+}
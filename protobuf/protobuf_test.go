@@ -0,0 +1,141 @@
+package protobuf
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snechholt/milk"
+	"github.com/snechholt/milk/protobuf/internal/testpb"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestRouter() *milk.Router {
+	r := milk.NewRouter()
+	r.NewLogger = func(c *milk.Context) milk.Logger { return &milk.RecordingLogger{} }
+	Register(r)
+	r.Post("/items", func(c *milk.Context) error {
+		var item testpb.Item
+		if err := c.ParseBody(&item); err != nil {
+			return err
+		}
+		if item.Name == "" {
+			verr := milk.NewValidationError()
+			verr.AddErrorDetailed("name", milk.ErrCodeRequired, nil, "")
+			verr.AddErrorDetailed("price", milk.ErrCodeValueTooHigh, 100, "")
+			return verr
+		}
+		item.Price *= 2
+		c.Result = &item
+		return nil
+	})
+	r.Post("/map", func(c *milk.Context) error {
+		var m map[string]interface{}
+		if err := c.ParseBody(&m); err != nil {
+			return err
+		}
+		c.Result = m
+		return nil
+	})
+	r.Get("/missing", func(c *milk.Context) error { return milk.NewError(404, "no such item") })
+	return r
+}
+
+func TestRoundTrip(t *testing.T) {
+	body, err := proto.Marshal(&testpb.Item{Name: "a", Price: 21})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/items", bytes.NewReader(body))
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Accept", ContentType)
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != ContentType {
+		t.Errorf("expected content type %s, got %s", ContentType, contentType)
+	}
+	var item testpb.Item
+	if err := proto.Unmarshal(w.Body.Bytes(), &item); err != nil {
+		t.Fatal(err)
+	}
+	if want := (&testpb.Item{Name: "a", Price: 42}); !proto.Equal(&item, want) {
+		t.Errorf("expected %v, got %v", want, &item)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	emptyItem, _ := proto.Marshal(&testpb.Item{Price: 1})
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		body   []byte
+		status int
+		want   *Error
+	}{
+		{
+			name:   "error",
+			method: "GET", url: "/missing",
+			status: 404, want: &Error{StatusCode: 404, Message: "no such item"},
+		},
+		{
+			name:   "validation error",
+			method: "POST", url: "/items", body: emptyItem,
+			status: 422, want: &Error{
+				StatusCode: 422, ErrorCode: "multi", Message: "Validation error. See errors array for details.",
+				Errors: []*FieldError{
+					{Key: "name", ErrorCode: milk.ErrCodeRequired},
+					{Key: "price", ErrorCode: milk.ErrCodeValueTooHigh, Data: "100"},
+				},
+			},
+		},
+		{
+			name:   "body not a message",
+			method: "POST", url: "/map", body: emptyItem,
+			status: 415, want: &Error{StatusCode: 415, Message: "Unsupported content type"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.url, bytes.NewReader(test.body))
+			req.Header.Set("Content-Type", ContentType)
+			req.Header.Set("Accept", ContentType)
+			w := httptest.NewRecorder()
+			newTestRouter().ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != ContentType {
+				t.Errorf("expected content type %s, got %s", ContentType, contentType)
+			}
+			var got Error
+			if err := proto.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(&got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, &got)
+			}
+		})
+	}
+}
+
+func TestJSONFallback(t *testing.T) {
+	req := httptest.NewRequest("POST", "/map", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", ContentType)
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected content type application/json, got %s", contentType)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"a":1}` {
+		t.Errorf("expected body {\"a\":1}, got %s", body)
+	}
+}
@@ -0,0 +1,201 @@
+package milk
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SetStatus sets the status code of the response sent with the Result when no handler returns an error,
+// e.g. http.StatusCreated. Codes outside the range 100-399 are ignored with a logged warning.
+func (this *Context) SetStatus(code int) {
+	if code < 100 || code >= 400 {
+		this.Warningf("ignoring invalid success status code %d", code)
+		return
+	}
+	this.status = code
+}
+
+// SetHeader sets the response header key to value, replacing any existing values.
+// Headers can't be changed once the response has been written, so a late call is ignored with a logged warning.
+func (this *Context) SetHeader(key, value string) {
+	if this.w.isWritten() {
+		this.Warningf("ignoring header %s set after the response was written", key)
+		return
+	}
+	this.W.Header().Set(key, value)
+}
+
+// AddHeader adds value to the response header key. Like SetHeader, it is ignored with a logged warning
+// once the response has been written.
+func (this *Context) AddHeader(key, value string) {
+	if this.w.isWritten() {
+		this.Warningf("ignoring header %s added after the response was written", key)
+		return
+	}
+	this.W.Header().Add(key, value)
+}
+
+// GetHeader returns the first value of the request header key, or an empty string if it is not present.
+func (this *Context) GetHeader(key string) string {
+	return this.R.Header.Get(key)
+}
+
+// Created sets the Location header to location, the status code to 201 and the Result to result,
+// for responding to requests creating an entity. The response is sent through the normal Result pipeline.
+func (this *Context) Created(location string, result interface{}) {
+	this.W.Header().Set("Location", location)
+	this.status = http.StatusCreated
+	this.Result = result
+}
+
+// NoContent makes the response a 204 with neither body nor Content-Type when no handler returns an error.
+// Any Result is ignored.
+func (this *Context) NoContent() {
+	this.status = http.StatusNoContent
+}
+
+// Redirect immediately redirects the client to location with the given 3xx status code and stops the chain.
+// Relative locations are resolved against the request URL. Returns an error for non-3xx codes and
+// unparseable locations, without writing anything.
+func (this *Context) Redirect(code int, location string) error {
+	if code < 300 || code > 399 {
+		return fmt.Errorf("milk: invalid redirect status code %d", code)
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("milk: invalid redirect location %q: %v", location, err)
+	}
+	this.W.Header().Set("Location", this.R.URL.ResolveReference(u).String())
+	this.W.WriteHeader(code)
+	this.Stop()
+	return nil
+}
+
+// streamChunkSize is the size of the chunks copied by Stream
+const streamChunkSize = 32 << 10
+
+// Stream copies r to the response with the given status code and content type without buffering the
+// whole content, flushing after every chunk if the underlying response writer supports it.
+// Returns the number of bytes written and any error reading r or writing the response.
+func (this *Context) Stream(status int, contentType string, r io.Reader) (int64, error) {
+	this.W.Header().Set("Content-Type", contentType)
+	this.W.WriteHeader(status)
+	buf := make([]byte, streamChunkSize)
+	var n int64
+	for {
+		nr, rerr := r.Read(buf)
+		if nr > 0 {
+			nw, werr := this.W.Write(buf[:nr])
+			n += int64(nw)
+			if werr != nil {
+				return n, werr
+			}
+			this.w.Flush()
+		}
+		if rerr == io.EOF {
+			return n, nil
+		} else if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// Upgrade hands the response writer and request to upgrade, a func performing a protocol upgrade like
+// a WebSocket handshake. This keeps the package free of any WebSocket dependency, e.g. with gorilla/websocket:
+//
+//	var conn *websocket.Conn
+//	err := c.Upgrade(func(w http.ResponseWriter, r *http.Request) (err error) {
+//		conn, err = upgrader.Upgrade(w, r, nil)
+//		return err
+//	})
+//
+// The response writer passed to upgrade implements http.Hijacker if the underlying writer does.
+// After a successful upgrade the response is marked as written and the chain is stopped, so the context
+// never touches the hijacked connection. A failed upgrade results in ErrBadRequest.
+func (this *Context) Upgrade(upgrade func(w http.ResponseWriter, r *http.Request) error) error {
+	if err := upgrade(this.W, this.R); err != nil {
+		this.Debugf("error upgrading connection: %v", err)
+		return ErrBadRequest
+	}
+	this.w.markWritten()
+	this.Stop()
+	return nil
+}
+
+// Attachment streams r to the client as a file download named filename, setting the Content-Disposition
+// header with an RFC 5987 encoded filename* parameter for non-ASCII names. If r reports its remaining
+// size through a Len() int method (like *bytes.Reader and *strings.Reader), Content-Length is set.
+func (this *Context) Attachment(filename string, contentType string, r io.Reader) error {
+	h := this.W.Header()
+	h.Set("Content-Disposition", contentDisposition(filename))
+	if l, ok := r.(interface{ Len() int }); ok {
+		h.Set("Content-Length", strconv.Itoa(l.Len()))
+	}
+	_, err := this.Stream(http.StatusOK, contentType, r)
+	return err
+}
+
+// File serves the file at path with http.ServeFile, supporting range and conditional requests.
+func (this *Context) File(path string) {
+	http.ServeFile(this.W, this.R, path)
+	this.w.markWritten()
+}
+
+// contentDisposition returns an attachment Content-Disposition header value for filename,
+// with an ASCII fallback filename parameter and an RFC 5987 encoded filename* parameter.
+func contentDisposition(filename string) string {
+	var fallback, encoded strings.Builder
+	for _, r := range filename {
+		switch {
+		case r == '"' || r == '\\':
+			fallback.WriteByte('\\')
+			fallback.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	for _, b := range []byte(filename) {
+		if isAttrChar(b) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback.String(), encoded.String())
+}
+
+// isAttrChar reports whether b may appear unencoded in an RFC 5987 ext-value.
+func isAttrChar(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		strings.IndexByte("!#$&+-.^_`|~", b) >= 0
+}
+
+// JSON immediately writes v encoded as JSON with the given status code, bypassing Result.
+// As for any handler writing to the response, the chain of handlers stops when the handler returns.
+// Returns any error encoding v or writing the response.
+func (this *Context) JSON(status int, v interface{}) error {
+	b, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return this.Blob(status, "application/json", b)
+}
+
+// Text immediately writes s as plain text with the given status code, bypassing Result.
+func (this *Context) Text(status int, s string) error {
+	return this.Blob(status, "text/plain; charset=utf-8", []byte(s))
+}
+
+// Blob immediately writes b with the given status code and content type, bypassing Result.
+func (this *Context) Blob(status int, contentType string, b []byte) error {
+	this.W.Header().Set("Content-Type", contentType)
+	this.W.WriteHeader(status)
+	_, err := this.W.Write(b)
+	return err
+}
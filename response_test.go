@@ -0,0 +1,485 @@
+package milk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// responderTest is a request to a route running handler, followed by a handler recording whether it runs.
+type responderTest struct {
+	name       string
+	method     string
+	url        string
+	handler    HandlerFunc
+	status     int
+	header     map[string]string // header is the expected response headers, "" meaning absent
+	body       string
+	warning    string // warning is a substring of an expected logged warning
+	stopsChain bool
+}
+
+// testResponders serves the requests of tests, checking the responses.
+func testResponders(t *testing.T, tests []responderTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			var reported []error
+			r.OnError(func(c *Context, err error) { reported = append(reported, err) })
+			var after bool
+			method, url := test.method, test.url
+			if method == "" {
+				method = "GET"
+			}
+			if url == "" {
+				url = "/x"
+			}
+			r.route(method, strings.SplitN(url, "?", 2)[0], test.handler, func(c *Context) error { after = true; return nil })
+			w := serveRequest(r, method, url, nil, "X-In", "in")
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body)
+			}
+			if got := w.Body.String(); strings.TrimSpace(got) != strings.TrimSpace(test.body) {
+				t.Errorf("expected body %q, got %q", test.body, got)
+			}
+			for key, value := range test.header {
+				if got := w.Header().Get(key); got != value {
+					t.Errorf("expected header %s %q, got %q", key, value, got)
+				}
+			}
+			if after == test.stopsChain {
+				t.Errorf("expected the chain to stop: %v, but the next handler ran: %v", test.stopsChain, after)
+			}
+			if test.warning != "" {
+				var found bool
+				for _, entry := range logger.Entries() {
+					found = found || entry.Level == "WARNING" && strings.Contains(entry.Message, test.warning)
+				}
+				if !found {
+					t.Errorf("expected a warning containing %q, got %v", test.warning, logger.Entries())
+				}
+			}
+			if test.status == 500 && len(reported) != 1 {
+				t.Errorf("expected the error to be reported to OnError once, got %v", reported)
+			}
+		})
+	}
+}
+
+func TestResponderMethods(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name:    "json",
+			handler: func(c *Context) error { return c.JSON(202, []int{1, 2}) },
+			status:  202, body: "[1,2]\n", header: map[string]string{"Content-Type": "application/json"}, stopsChain: true,
+		},
+		{
+			name:    "text",
+			handler: func(c *Context) error { return c.Text(200, "hello") },
+			status:  200, body: "hello", header: map[string]string{"Content-Type": "text/plain; charset=utf-8"}, stopsChain: true,
+		},
+		{
+			name:    "blob",
+			handler: func(c *Context) error { return c.Blob(200, "image/png", []byte{0x89, 'P'}) },
+			status:  200, body: "\x89P", header: map[string]string{"Content-Type": "image/png"}, stopsChain: true,
+		},
+	})
+}
+
+func TestSetStatus(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name:    "set status",
+			handler: func(c *Context) error { c.SetStatus(201); c.Result = "made"; return nil },
+			status:  201, body: `"made"`,
+		},
+		{
+			name:    "set invalid status",
+			handler: func(c *Context) error { c.SetStatus(500); c.Result = "ok"; return nil },
+			status:  200, body: `"ok"`, warning: "invalid success status code 500",
+		},
+	})
+}
+
+func TestCreated(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name:    "created",
+			handler: func(c *Context) error { c.Created("/users/1", map[string]int{"id": 1}); return nil },
+			status:  201, body: `{"id":1}`, header: map[string]string{"Location": "/users/1", "Content-Type": "application/json"},
+		},
+	})
+}
+
+func TestNoContent(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name:    "no content",
+			handler: func(c *Context) error { c.NoContent(); c.Result = "ignored"; return nil },
+			status:  204, header: map[string]string{"Content-Type": ""},
+		},
+	})
+}
+
+func TestRedirect(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name:    "redirect",
+			handler: func(c *Context) error { return c.Redirect(302, "https://example.com/x") },
+			status:  302, header: map[string]string{"Location": "https://example.com/x", "Content-Type": ""}, stopsChain: true,
+		},
+		{
+			name:    "permanent relative redirect",
+			url:     "/a/b?q=1",
+			handler: func(c *Context) error { return c.Redirect(308, "../c") },
+			status:  308, header: map[string]string{"Location": "/c"}, stopsChain: true,
+		},
+		{
+			name:    "invalid redirect code",
+			handler: func(c *Context) error { return c.Redirect(200, "/x") },
+			status:  500, header: map[string]string{"Location": ""}, stopsChain: true,
+		},
+	})
+}
+
+func TestHeaders(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name: "headers",
+			handler: func(c *Context) error {
+				c.SetHeader("X-Set", "1")
+				c.AddHeader("X-Add", "a")
+				c.AddHeader("X-Add", "b")
+				c.Result = c.GetHeader("X-In")
+				return nil
+			},
+			status: 200, body: `"in"`, header: map[string]string{"X-Set": "1", "X-Add": "a"},
+		},
+		{
+			name: "header set after writing",
+			handler: func(c *Context) error {
+				c.Text(200, "x")
+				c.SetHeader("X-Late", "1")
+				c.AddHeader("X-Late", "2")
+				return nil
+			},
+			status: 200, body: "x", header: map[string]string{"X-Late": ""}, warning: "ignoring header X-Late", stopsChain: true,
+		},
+	})
+}
+
+func TestAttachment(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name: "attachment",
+			handler: func(c *Context) error {
+				return c.Attachment(`résumé "v2".pdf`, "application/pdf", strings.NewReader("%PDF"))
+			},
+			status: 200, body: "%PDF", stopsChain: true,
+			header: map[string]string{
+				"Content-Disposition": `attachment; filename="r_sum_ \"v2\".pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9%20%22v2%22.pdf`,
+				"Content-Length":      "4",
+				"Content-Type":        "application/pdf",
+			},
+		},
+	})
+}
+
+func TestHeadResponses(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name:    "head",
+			method:  "HEAD",
+			handler: func(c *Context) error { c.Result = map[string]string{"a": "b"}; return nil },
+			status:  200, header: map[string]string{"Content-Length": "10", "Content-Type": "application/json"},
+		},
+		{
+			name:    "head with pretty json",
+			method:  "HEAD",
+			url:     "/x?pretty=1",
+			handler: func(c *Context) error { c.Result = map[string]string{"a": "b"}; return nil },
+			status:  200, header: map[string]string{"Content-Length": "14", "Content-Type": "application/json"},
+		},
+	})
+}
+
+func TestUnencodableResult(t *testing.T) {
+	testResponders(t, []responderTest{
+		{
+			name:    "unencodable result",
+			handler: func(c *Context) error { c.Result = make(chan int); return nil },
+			status:  500, body: `{"statusCode":500,"message":"response serialization failed"}`,
+			header: map[string]string{"Content-Type": "application/json"},
+		},
+	})
+}
+
+func TestAddHeaderKeepsValues(t *testing.T) {
+	r, _ := newTestRouter()
+	r.Get("/x", func(c *Context) error {
+		c.AddHeader("Vary", "Accept")
+		c.AddHeader("Vary", "Origin")
+		return nil
+	})
+	w := serveRequest(r, "GET", "/x", nil)
+	if got := strings.Join(w.Header().Values("Vary"), ","); got != "Accept,Origin" {
+		t.Errorf("expected Vary Accept,Origin, got %q", got)
+	}
+}
+
+// countingResponseWriter counts the bytes and flushes of a response without keeping the body.
+type countingResponseWriter struct {
+	header  http.Header
+	status  int
+	n       int64
+	flushes int
+}
+
+func (this *countingResponseWriter) Header() http.Header {
+	if this.header == nil {
+		this.header = make(http.Header)
+	}
+	return this.header
+}
+
+func (this *countingResponseWriter) Write(b []byte) (int, error) {
+	this.n += int64(len(b))
+	return len(b), nil
+}
+
+func (this *countingResponseWriter) WriteHeader(statusCode int) {
+	this.status = statusCode
+}
+
+func (this *countingResponseWriter) Flush() {
+	this.flushes++
+}
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int64
+		flushes int
+	}{
+		{name: "empty", size: 0, flushes: 0},
+		{name: "one chunk", size: 100, flushes: 1},
+		{name: "several megabytes", size: 5 << 20, flushes: 5 << 20 / streamChunkSize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var written int64
+			r.Get("/x", func(c *Context) error {
+				n, err := c.Stream(200, "application/octet-stream", io.LimitReader(zeroReader{}, test.size))
+				written = n
+				return err
+			})
+			w := &countingResponseWriter{}
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/x", nil))
+			if w.status != 200 || w.n != test.size || written != test.size {
+				t.Errorf("expected status 200 and %d bytes, got status %d, %d bytes written and %d returned", test.size, w.status, w.n, written)
+			}
+			// the headers are flushed once up front only if there's a chunk to send
+			if w.flushes != test.flushes {
+				t.Errorf("expected %d flushes, got %d", test.flushes, w.flushes)
+			}
+			if got := w.Header().Get("Content-Type"); got != "application/octet-stream" {
+				t.Errorf("expected content type application/octet-stream, got %q", got)
+			}
+		})
+	}
+}
+
+// zeroReader reads an endless stream of zero bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = 0
+	}
+	return len(b), nil
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.txt")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		header []string
+		status int
+		body   string
+	}{
+		{name: "whole file", status: 200, body: "0123456789"},
+		{name: "range", header: []string{"Range", "bytes=2-4"}, status: 206, body: "234"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var after bool
+			r.Get("/x", func(c *Context) error { c.File(path); return nil }, func(c *Context) error { after = true; return nil })
+			w := serveRequest(r, "GET", "/x", nil, test.header...)
+			if w.Code != test.status || w.Body.String() != test.body {
+				t.Errorf("expected %d %q, got %d %q", test.status, test.body, w.Code, w.Body)
+			}
+			if after {
+				t.Error("expected the chain to stop after serving the file")
+			}
+		})
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		upgrade func(w http.ResponseWriter, r *http.Request) error
+		status  int
+		echo    bool
+	}{
+		{
+			name: "hijacked",
+			upgrade: func(w http.ResponseWriter, r *http.Request) error {
+				conn, rw, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					return err
+				}
+				go func() {
+					defer conn.Close()
+					rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+					rw.Flush()
+					line, _ := rw.ReadString('\n')
+					rw.WriteString(line)
+					rw.Flush()
+				}()
+				return nil
+			},
+			status: 101, echo: true,
+		},
+		{
+			name:    "failed handshake",
+			upgrade: func(w http.ResponseWriter, r *http.Request) error { return fmt.Errorf("missing Sec-WebSocket-Key") },
+			status:  400,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var after bool
+			r.Get("/ws", func(c *Context) error { return c.Upgrade(test.upgrade) }, func(c *Context) error { after = true; return nil })
+			server := httptest.NewServer(r)
+			defer server.Close()
+
+			conn, err := net.Dial("tcp", server.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+			br := bufio.NewReader(conn)
+			res, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, res.StatusCode)
+			}
+			if test.echo {
+				fmt.Fprintf(conn, "ping\n")
+				if line, _ := br.ReadString('\n'); line != "ping\n" {
+					t.Errorf("expected the hijacked connection to echo ping, got %q", line)
+				}
+			}
+			if after {
+				t.Error("expected the chain to stop after the upgrade")
+			}
+		})
+	}
+}
+
+// hijackableRecorder is a ResponseRecorder supporting hijacking with an in-memory connection.
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (this *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	this.hijacked = true
+	server, client := net.Pipe()
+	client.Close()
+	return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+}
+
+func TestResponseWriterPassThrough(t *testing.T) {
+	tests := []struct {
+		name     string
+		w        http.ResponseWriter
+		flushed  bool
+		hijacked bool
+	}{
+		{name: "flusher", w: httptest.NewRecorder(), flushed: true},
+		{name: "hijacker", w: &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}, flushed: true, hijacked: true},
+		{name: "plain", w: &plainResponseWriter{httptest.NewRecorder()}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var hijackErr error
+			var status int
+			r.Get("/x", func(c *Context) error {
+				// flushing a writer without support for it is a no-op, leaving the response unwritten
+				c.W.(http.Flusher).Flush()
+				status = c.ResponseStatus()
+				if h, ok := c.W.(http.Hijacker); ok {
+					var conn net.Conn
+					if conn, _, hijackErr = h.Hijack(); conn != nil {
+						conn.Close()
+					}
+				}
+				return nil
+			})
+			r.ServeHTTP(test.w, httptest.NewRequest("GET", "/x", nil))
+			if want := map[bool]int{true: 200, false: 0}[test.flushed]; status != want {
+				t.Errorf("expected status %d after flushing, got %d", want, status)
+			}
+			if (hijackErr == nil) != test.hijacked {
+				t.Errorf("expected hijacking to succeed: %v, got %v", test.hijacked, hijackErr)
+			}
+			if hr, ok := test.w.(*hijackableRecorder); ok && !hr.hijacked {
+				t.Error("expected the underlying writer to be hijacked")
+			}
+		})
+	}
+}
+
+// plainResponseWriter hides the optional interfaces of the wrapped response writer.
+type plainResponseWriter struct {
+	w *httptest.ResponseRecorder
+}
+
+func (this *plainResponseWriter) Header() http.Header         { return this.w.Header() }
+func (this *plainResponseWriter) Write(b []byte) (int, error) { return this.w.Write(b) }
+func (this *plainResponseWriter) WriteHeader(statusCode int)  { this.w.WriteHeader(statusCode) }
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "report.csv", want: `attachment; filename="report.csv"; filename*=UTF-8''report.csv`},
+		{filename: "a b\\c", want: `attachment; filename="a b\\c"; filename*=UTF-8''a%20b%5Cc`},
+		{filename: "日本.txt", want: `attachment; filename="__.txt"; filename*=UTF-8''%E6%97%A5%E6%9C%AC.txt`},
+	}
+	for _, test := range tests {
+		if got := contentDisposition(test.filename); got != test.want {
+			t.Errorf("contentDisposition(%q): expected %s, got %s", test.filename, test.want, got)
+		}
+	}
+}
@@ -2,40 +2,252 @@ package milk
 
 import (
 	"context"
+	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"net"
 	"net/http"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
 )
 
+// methods lists the request methods a mounted http.Handler is registered for
+var methods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+
+// DefaultTimeout is the Timeout of root routers not setting one. It is zero, meaning no timeout, by default.
+// On platforms with a hard request deadline, like App Engine, set it slightly under the deadline, e.g. to
+// 55 * time.Second, so handlers see the deadline on their context and clients get a 503 JSON response rather
+// than the platform's error. Long-lived responses, like event streams, then need a route Timeout of their own.
+var DefaultTimeout time.Duration
+
+// pkgPath is the import path of the package, used to find the caller registering a route
+var pkgPath = reflect.TypeOf(Router{}).PkgPath()
+
 type HandlerFunc func(c *Context) error
 
 type CreateContextFn func(r *http.Request) context.Context
 
+// CreateContextEFn is a CreateContextFn that may fail. A failure is logged and answered with a 500 response
+// without running any handlers.
+type CreateContextEFn func(r *http.Request) (context.Context, error)
+
+// contextKey is the type of keys used for storing values on the request's context.Context
+type contextKey int
+
+const (
+	originalMethodKey contextKey = iota
+)
+
 type Router struct {
+	// CreateContext creates the context.Context of requests to the router's routes.
+	// A router without CreateContext (or CreateContextE) inherits the func of its nearest parent having one.
+	// NewRouter sets a default func returning context.Background(), which is cleared when the router is mounted
+	// with MountRouter; when it is cleared with ClearCreateContext and no func is set anywhere, the request's own
+	// context is used.
 	CreateContext CreateContextFn
-	parent        *Router
-	r             *httprouter.Router
-	path          string
-	mw            []HandlerFunc
+
+	// CreateContextE takes precedence over CreateContext when set on the same router.
+	CreateContextE CreateContextEFn
+
+	// MethodOverride enables overriding the method of POST requests by the X-HTTP-Method-Override header.
+	// The original method is stored in the context's Values under KeyOriginalMethod.
+	MethodOverride bool
+
+	// NewLogger creates the Logger of a request, used by the context's logging methods and for the messages
+	// logged by the package, e.g. to log with a logging service. It is called on the first message of a request.
+	// If not set, the NewLogger of the parent router is used, or the standard log package for root routers.
+	NewLogger func(c *Context) Logger
+
+	// PanicHandler is called after a panic in a handler has been recovered and logged, e.g. for reporting
+	// the panic to an error tracker. The panic is recorded as an error on the context before PanicHandler is called.
+	// If not set, the PanicHandler of the parent router is used.
+	PanicHandler func(c *Context, v interface{})
+
+	// NotFoundMiddleware makes the router's middleware run for requests that don't match any route.
+	// The middleware is followed by the handlers set with NotFound or MethodNotAllowed, or by a handler
+	// returning ErrNotFound if none are set.
+	NotFoundMiddleware bool
+
+	// Timeout limits the time the handlers of the router's routes may take. If no handler has written a response
+	// or returned when the timeout fires, a 503 JSON response is sent and later writes by the handlers are discarded.
+	// The context passed to the handlers is cancelled when the timeout fires.
+	// If not set, the Timeout of the parent router is used, or DefaultTimeout for root routers.
+	// Routes may override it with Route.Timeout.
+	Timeout time.Duration
+
+	// MaxBodySize is the maximum size in bytes of request bodies read by Context.ParseBody.
+	// If not set, the MaxBodySize of the parent router is used, or DefaultMaxBodySize for root routers.
+	MaxBodySize int64
+
+	// EmptyResultStatus is the status code of successful responses without a Result, e.g. http.StatusNoContent.
+	// If not set, the EmptyResultStatus of the parent router is used, or 200 for root routers.
+	EmptyResultStatus int
+
+	// DateFormats are the layouts, tried in order, of dates parsed by Params.GetDate and Params.GetTime, by the
+	// GetTime methods of Context.Headers and Context.Cookies, and of the time.Time fields filled by the Bind methods.
+	// If not set, the DateFormats of the parent router are used, or the DateFormat variable for root routers.
+	DateFormats []string
+
+	// Location is the location of times without a time zone offset parsed by Params.GetTimeIn for requests
+	// not naming one. If not set, the Location of the parent router is used, or UTC for root routers.
+	Location *time.Location
+
+	// CursorKey is the HMAC key signing the cursors of Context.EncodeCursor and verifying those read by
+	// Params.Cursor. If not set, the CursorKey of the parent router is used, or DefaultCursorKey for root routers.
+	CursorKey []byte
+
+	// CursorTTL is how long the cursors of Context.EncodeCursor are valid. If not set, the CursorTTL of the parent
+	// router is used, or DefaultCursorTTL for root routers.
+	CursorTTL time.Duration
+
+	// DurationUnit is the unit of bare integer durations read by Params.GetDuration, e.g. time.Second for ?ttl=300.
+	// A negative DurationUnit rejects bare integers other than 0, as time.ParseDuration does.
+	// If not set, the DurationUnit of the parent router is used, or DefaultDurationUnit for root routers.
+	DurationUnit time.Duration
+
+	// UUIDHyphensRequired makes Params.GetUUID of the router and its sub-routers reject UUIDs without hyphens,
+	// e.g. 6ba7b8109dad11d180b400c04fd430c8.
+	UUIDHyphensRequired bool
+
+	// MaxJSONParamSize is the maximum length in bytes of values decoded by Params.GetJSON.
+	// If not set, the MaxJSONParamSize of the parent router is used, or DefaultMaxJSONParamSize for root routers.
+	MaxJSONParamSize int
+
+	// MaxBase64ParamSize is the maximum size in bytes of values decoded by Params.GetBase64.
+	// If not set, the MaxBase64ParamSize of the parent router is used, or DefaultMaxBase64ParamSize for root routers.
+	MaxBase64ParamSize int
+
+	// PrettyJSON makes JSON responses of the router and its sub-routers indented, e.g. for development environments.
+	// Regardless of PrettyJSON, requests can ask for indented JSON with the query parameter pretty=1.
+	PrettyJSON bool
+
+	// PrettyJSONMaxSize is the maximum size in bytes of compact JSON responses that are indented when pretty
+	// printing is enabled. Larger responses are sent compact. If not set, the PrettyJSONMaxSize of the parent router
+	// is used, or DefaultPrettyJSONMaxSize for root routers.
+	PrettyJSONMaxSize int
+
+	// ResponseTransformer is called before encoding the response with the Result, or the error of the response
+	// if any handler failed, and returns the value to encode instead, e.g. for wrapping every payload in an envelope.
+	// For errors, c.Result holds the default error payload, if any. Returning nil encodes the default payload.
+	// It isn't called for responses written by the handlers themselves or for 204 responses.
+	// If not set, the ResponseTransformer of the parent router is used.
+	ResponseTransformer func(c *Context, result interface{}, err error) interface{}
+
+	// ETags makes successful 200 responses of the router and its sub-routers carry an ETag computed by hashing
+	// the encoded Result. Requests with a matching If-None-Match header are answered with a 304 without a body.
+	// Computing the ETag requires buffering the encoded Result. See also Context.ETag.
+	ETags bool
+
+	// JSONP makes the routes of the router and its sub-routers answer requests with a callback query parameter
+	// with JSONP for legacy browser clients: the JSON response is wrapped in a call to the callback and sent as
+	// application/javascript. Requests with an invalid callback name are rejected with a ValidationError.
+	// Routes may enable JSONP individually with Route.JSONP.
+	JSONP bool
+
+	// XML makes the routes of the router and its sub-routers answer requests preferring application/xml or text/xml
+	// in their Accept header with XML. Without it, XML is only sent when a handler sets the ResponseFormat to
+	// FormatXML, as browsers rank XML above the */* matching JSON, and encoding/xml can't encode maps.
+	XML bool
+
+	// CSVDelimiter is the field delimiter of CSV responses written by Context.CSV and Context.CSVStructs,
+	// e.g. ';' for spreadsheets in locales using a decimal comma. If not set, the CSVDelimiter of the parent
+	// router is used, or ',' for root routers.
+	CSVDelimiter rune
+
+	parent *Router
+	r      Backend
+	path   string // path is the router's path prefix relative to its parent
+	mw     []HandlerFunc
+	routes []*Route  // routes holds every route registered on the root router and its descendants
+	host   string    // host is the host pattern requests must match to be routed by the router
+	hosts  []*Router // hosts holds the host routers created on the root router and its descendants
+
+	deprecation *deprecation
+
+	notFound         []HandlerFunc
+	methodNotAllowed []HandlerFunc
+
+	debug *bool // debug is set by Debug
+
+	onError  []func(c *Context, err error)
+	onFinish []func(c *Context)
+
+	encoders []*encoder         // encoders holds the encoders registered with RegisterEncoder
+	decoders map[string]Decoder // decoders holds the decoders registered with RegisterDecoder by content type
+
+	newBackend     func() Backend
+	httprouterOpts []func(*httprouter.Router)
 }
 
-type notfound struct {
+// Route is a single method and path registered on a Router.
+type Route struct {
+	method   string
+	path     string
+	router   *Router
+	handlers []HandlerFunc
+	skipMw   bool          // skipMw is set when the route should not run any router middleware
+	timeout  time.Duration // timeout overrides the router's Timeout when set
+	source   string        // source is the file:line the route was registered from
+
+	deprecation *deprecation
+	streamBody  bool
+	jsonp       bool
 }
 
-func (this *notfound) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(404)
+// deprecation holds the sunset date and replacement link of a deprecated route.
+type deprecation struct {
+	sunset time.Time
+	link   string
 }
 
-func NewRouter() *Router {
+// setHeaders sets the Deprecation, Sunset and Link headers of the deprecation.
+func (this *deprecation) setHeaders(h http.Header) {
+	h.Set("Deprecation", "true")
+	if !this.sunset.IsZero() {
+		h.Set("Sunset", this.sunset.UTC().Format(http.TimeFormat))
+	}
+	if this.link != "" {
+		h.Add("Link", "<"+this.link+`>; rel="successor-version"`)
+	}
+}
+
+// backgroundContext is the default CreateContext func set by NewRouter.
+func backgroundContext(r *http.Request) context.Context {
+	return context.Background()
+}
+
+func NewRouter(opts ...RouterOption) *Router {
+	router := &Router{
+		CreateContext: backgroundContext,
+	}
+	for _, opt := range opts {
+		opt(router)
+	}
+	router.r = router.backend()
+	router.r.SetNotFound(router.fallback(func() []HandlerFunc { return router.notFound }))
+	router.r.SetMethodNotAllowed(router.fallback(func() []HandlerFunc { return router.methodNotAllowed }))
+	if b, ok := router.r.(OptionsBackend); ok {
+		b.SetOptions(router.options())
+	}
+	return router
+}
+
+// backend creates a new routing backend as configured on the root router.
+func (this *Router) backend() Backend {
+	root := this.root()
+	if root.newBackend != nil {
+		return root.newBackend()
+	}
 	r := httprouter.New()
-	r.NotFound = new(notfound)
-	r.MethodNotAllowed = new(notfound)
-	return &Router{
-		CreateContext: func(r *http.Request) context.Context { return context.Background() },
-		r:             r,
+	for _, fn := range root.httprouterOpts {
+		fn(r)
 	}
+	return &httprouterBackend{r: r}
 }
 
-func (this *Router) router() *httprouter.Router {
+func (this *Router) router() Backend {
 	if this.r != nil {
 		return this.r
 	} else {
@@ -43,6 +255,34 @@ func (this *Router) router() *httprouter.Router {
 	}
 }
 
+func (this *Router) root() *Router {
+	if this.parent != nil {
+		return this.parent.root()
+	} else {
+		return this
+	}
+}
+
+// fullPath returns the router's path prefix including the prefixes of all its parents.
+func (this *Router) fullPath() string {
+	if this.parent != nil {
+		return this.parent.fullPath() + this.path
+	} else {
+		return this.path
+	}
+}
+
+// within reports whether the router is r or one of r's descendants.
+func (this *Router) within(r *Router) bool {
+	if this == r {
+		return true
+	} else if this.parent != nil {
+		return this.parent.within(r)
+	} else {
+		return false
+	}
+}
+
 func (this *Router) middleware() []HandlerFunc {
 	var fns []HandlerFunc
 	if this.parent != nil {
@@ -52,53 +292,718 @@ func (this *Router) middleware() []HandlerFunc {
 	return fns
 }
 
-func (this *Router) createContext(r *http.Request) context.Context {
-	if this.CreateContext != nil {
-		return this.CreateContext(r)
+func (this *Router) createContext(r *http.Request) (context.Context, error) {
+	if this.CreateContextE != nil {
+		return this.CreateContextE(r)
+	} else if this.CreateContext != nil {
+		return this.CreateContext(r), nil
 	} else if this.parent != nil {
 		return this.parent.createContext(r)
 	} else {
-		panic("No CreateContext func is set")
+		return r.Context(), nil
+	}
+}
+
+// hasDefaultCreateContext reports whether the router's CreateContext is still the default set by NewRouter.
+func (this *Router) hasDefaultCreateContext() bool {
+	return this.CreateContextE == nil && this.CreateContext != nil &&
+		reflect.ValueOf(this.CreateContext).Pointer() == reflect.ValueOf(backgroundContext).Pointer()
+}
+
+// ClearCreateContext removes the CreateContext and CreateContextE funcs of the router, making it inherit
+// the func of its parent. On a root router it clears the default set by NewRouter.
+func (this *Router) ClearCreateContext() {
+	this.CreateContext = nil
+	this.CreateContextE = nil
+}
+
+func (this *Router) newLogger() func(c *Context) Logger {
+	if this.NewLogger != nil {
+		return this.NewLogger
+	} else if this.parent != nil {
+		return this.parent.newLogger()
+	} else {
+		return nil
+	}
+}
+
+func (this *Router) panicHandler() func(c *Context, v interface{}) {
+	if this.PanicHandler != nil {
+		return this.PanicHandler
+	} else if this.parent != nil {
+		return this.parent.panicHandler()
+	} else {
+		return nil
+	}
+}
+
+func (this *Router) timeout() time.Duration {
+	if this.Timeout > 0 {
+		return this.Timeout
+	} else if this.parent != nil {
+		return this.parent.timeout()
+	} else {
+		return DefaultTimeout
+	}
+}
+
+// Deprecated marks all routes of the router and its sub-routers as deprecated. Their responses carry
+// a "Deprecation: true" header, a Sunset header with the sunset date (unless zero) and a Link header
+// pointing to the replacement (unless empty), whether the handlers succeed or fail.
+func (this *Router) Deprecated(sunset time.Time, link string) {
+	this.deprecation = &deprecation{sunset: sunset, link: link}
+}
+
+func (this *Router) deprecated() *deprecation {
+	if this.deprecation != nil {
+		return this.deprecation
+	} else if this.parent != nil {
+		return this.parent.deprecated()
+	} else {
+		return nil
+	}
+}
+
+func (this *Router) maxBodySize() int64 {
+	if this.MaxBodySize > 0 {
+		return this.MaxBodySize
+	} else if this.parent != nil {
+		return this.parent.maxBodySize()
+	} else {
+		return DefaultMaxBodySize
+	}
+}
+
+func (this *Router) dateFormats() []string {
+	if len(this.DateFormats) > 0 {
+		return this.DateFormats
+	} else if this.parent != nil {
+		return this.parent.dateFormats()
+	} else {
+		return nil
+	}
+}
+
+func (this *Router) location() *time.Location {
+	if this.Location != nil {
+		return this.Location
+	} else if this.parent != nil {
+		return this.parent.location()
+	} else {
+		return time.UTC
+	}
+}
+
+func (this *Router) cursorKey() []byte {
+	if len(this.CursorKey) > 0 {
+		return this.CursorKey
+	} else if this.parent != nil {
+		return this.parent.cursorKey()
+	} else {
+		return DefaultCursorKey
+	}
+}
+
+func (this *Router) cursorTTL() time.Duration {
+	if this.CursorTTL > 0 {
+		return this.CursorTTL
+	} else if this.parent != nil {
+		return this.parent.cursorTTL()
+	} else {
+		return DefaultCursorTTL
+	}
+}
+
+func (this *Router) durationUnit() time.Duration {
+	if this.DurationUnit != 0 {
+		return this.DurationUnit
+	} else if this.parent != nil {
+		return this.parent.durationUnit()
+	} else {
+		return DefaultDurationUnit
+	}
+}
+
+func (this *Router) uuidHyphensRequired() bool {
+	return this.UUIDHyphensRequired || (this.parent != nil && this.parent.uuidHyphensRequired())
+}
+
+func (this *Router) maxJSONParamSize() int {
+	if this.MaxJSONParamSize > 0 {
+		return this.MaxJSONParamSize
+	} else if this.parent != nil {
+		return this.parent.maxJSONParamSize()
+	} else {
+		return DefaultMaxJSONParamSize
+	}
+}
+
+func (this *Router) maxBase64ParamSize() int {
+	if this.MaxBase64ParamSize > 0 {
+		return this.MaxBase64ParamSize
+	} else if this.parent != nil {
+		return this.parent.maxBase64ParamSize()
+	} else {
+		return DefaultMaxBase64ParamSize
+	}
+}
+
+func (this *Router) prettyJSON() bool {
+	return this.PrettyJSON || (this.parent != nil && this.parent.prettyJSON())
+}
+
+func (this *Router) xml() bool {
+	return this.XML || (this.parent != nil && this.parent.xml())
+}
+
+func (this *Router) etags() bool {
+	return this.ETags || (this.parent != nil && this.parent.etags())
+}
+
+func (this *Router) prettyJSONMaxSize() int {
+	if this.PrettyJSONMaxSize > 0 {
+		return this.PrettyJSONMaxSize
+	} else if this.parent != nil {
+		return this.parent.prettyJSONMaxSize()
+	} else {
+		return DefaultPrettyJSONMaxSize
+	}
+}
+
+func (this *Router) responseTransformer() func(c *Context, result interface{}, err error) interface{} {
+	if this.ResponseTransformer != nil {
+		return this.ResponseTransformer
+	} else if this.parent != nil {
+		return this.parent.responseTransformer()
+	} else {
+		return nil
+	}
+}
+
+// OnError registers fn to be called with the error of every response failing, e.g. for reporting errors to
+// an error tracker. It is called after the response has been written, so fn can read Context.ResponseStatus.
+// Hooks registered on a router apply to its sub-routers as well, and are called in order of registration,
+// starting with the hooks of the root router. A panic in fn is recovered and logged.
+func (this *Router) OnError(fn func(c *Context, err error)) {
+	this.onError = append(this.onError, fn)
+}
+
+func (this *Router) errorHooks() []func(c *Context, err error) {
+	var fns []func(c *Context, err error)
+	if this.parent != nil {
+		fns = this.parent.errorHooks()
+	}
+	return append(fns, this.onError...)
+}
+
+// OnFinish registers fn to be called after every response of the router and its sub-routers has been written,
+// e.g. for emitting metrics or finishing trace spans. It is called after the functions registered with
+// Context.Defer, even if a handler panicked, and can read Context.ResponseStatus and Context.ResponseSize.
+// Hooks are called in order of registration, starting with the hooks of the root router. A panic in fn is
+// recovered and logged.
+func (this *Router) OnFinish(fn func(c *Context)) {
+	this.onFinish = append(this.onFinish, fn)
+}
+
+func (this *Router) finishHooks() []func(c *Context) {
+	var fns []func(c *Context)
+	if this.parent != nil {
+		fns = this.parent.finishHooks()
+	}
+	return append(fns, this.onFinish...)
+}
+
+func (this *Router) emptyResultStatus() int {
+	if this.EmptyResultStatus != 0 {
+		return this.EmptyResultStatus
+	} else if this.parent != nil {
+		return this.parent.emptyResultStatus()
+	} else {
+		return 0
 	}
 }
 
 func (this *Router) SubRouter(path string) *Router {
 	sub := &Router{
 		parent: this,
-		path:   this.path + path,
+		path:   path,
+	}
+	return sub
+}
+
+// Group creates a sub-router for path and passes it to fn for registering routes and middleware.
+// Middleware added to the group only applies to routes in the group. Group returns the router itself
+// so that calls can be chained.
+func (this *Router) Group(path string, fn func(g *Router)) *Router {
+	fn(this.SubRouter(path))
+	return this
+}
+
+// Version creates a sub-router at "/"+v whose requests have the version stored under KeyAPIVersion in
+// the context's Values. Handlers shared between versions can read it with Context.APIVersion.
+func (this *Router) Version(v string) *Router {
+	sub := this.SubRouter("/" + v)
+	sub.Use(func(c *Context) error {
+		c.Values.Set(KeyAPIVersion, v)
+		return nil
+	})
+	return sub
+}
+
+// Host returns a sub-router whose routes only match requests for the given host.
+// pattern is either an exact host name or a wildcard like "*.example.com" matching any subdomain.
+// Requests for other hosts, or for paths not registered on the host router, fall through to the default routes.
+func (this *Router) Host(pattern string) *Router {
+	sub := &Router{
+		parent: this,
+		r:      this.backend(),
+		host:   strings.ToLower(pattern),
 	}
+	root := this.root()
+	root.hosts = append(root.hosts, sub)
 	return sub
 }
 
-func (this *Router) route(method, path string, handlers ...HandlerFunc) {
-	// if path[0] != '/' {
-	// 	panic("path must begin with '/' in path '" + path + "'") // taken directly from httprouter
-	// }
-	fns := this.middleware()
-	fns = append(fns, handlers...)
-	this.router().Handle(method, this.path+path, wrap(this.createContext, fns...))
+// MountRouter mounts child below path, composing it into this router's routing tree.
+// Routes registered on child and its sub-routers, both before and after mounting, are served by this router.
+// The child's middleware and CreateContext func are preserved and run after those of this router. The default
+// CreateContext set by NewRouter is cleared, so a child without its own func inherits the func of this router.
+// Settings only read from the root router are ignored once the child is mounted: handlers set on the child with
+// NotFound or MethodNotAllowed before mounting, NotFoundMiddleware, MethodOverride and the RouterOptions of NewRouter.
+func (this *Router) MountRouter(path string, child *Router) {
+	if child.hasDefaultCreateContext() {
+		child.CreateContext = nil
+	}
+	routes := child.routes
+	child.parent = this
+	child.path = path + child.path
+	child.r = nil
+	child.routes = nil
+	root := this.root()
+	root.hosts = append(root.hosts, child.hosts...)
+	child.hosts = nil
+	for _, route := range routes {
+		if route.router.router() == this.router() {
+			// routes of host routers are already registered on the host router's own tree
+			route.register()
+		}
+		root.routes = append(root.routes, route)
+	}
+}
+
+// route registers the route, panicking with the method, full path and caller of the registration
+// if the route is invalid or conflicts with another route.
+func (this *Router) route(method, path string, handlers ...HandlerFunc) *Route {
+	route := &Route{method: method, path: path, router: this, handlers: handlers, source: caller()}
+	if path != "" && path[0] != '/' {
+		route.panicf("path must begin with '/'")
+	} else if route.fullPath() == "" {
+		route.panicf("path is empty")
+	} else if len(handlers) == 0 {
+		route.panicf("no handlers")
+	}
+	route.register()
+	root := this.root()
+	root.routes = append(root.routes, route)
+	return route
+}
+
+func (this *Router) Get(path string, fns ...HandlerFunc) *Route {
+	return this.route("GET", path, fns...)
+}
+
+func (this *Router) Head(path string, fns ...HandlerFunc) *Route {
+	return this.route("HEAD", path, fns...)
+}
+
+func (this *Router) Post(path string, fns ...HandlerFunc) *Route {
+	return this.route("POST", path, fns...)
 }
 
-func (this *Router) Get(path string, fns ...HandlerFunc)    { this.route("GET", path, fns...) }
-func (this *Router) Post(path string, fns ...HandlerFunc)   { this.route("POST", path, fns...) }
-func (this *Router) Put(path string, fns ...HandlerFunc)    { this.route("PUT", path, fns...) }
-func (this *Router) Delete(path string, fns ...HandlerFunc) { this.route("DELETE", path, fns...) }
+func (this *Router) Put(path string, fns ...HandlerFunc) *Route {
+	return this.route("PUT", path, fns...)
+}
+
+func (this *Router) Patch(path string, fns ...HandlerFunc) *Route {
+	return this.route("PATCH", path, fns...)
+}
+
+func (this *Router) Delete(path string, fns ...HandlerFunc) *Route {
+	return this.route("DELETE", path, fns...)
+}
+
+func (this *Router) Options(path string, fns ...HandlerFunc) *Route {
+	return this.route("OPTIONS", path, fns...)
+}
+
+// Handler registers h for requests with the given method and path. Middleware registered on the router
+// runs before h and may stop the chain, e.g. by returning ErrForbidden. h writes its own response.
+func (this *Router) Handler(method, path string, h http.Handler) *Route {
+	return this.route(method, path, handlerFunc(h))
+}
+
+// Mount registers h for every request method on the whole subtree below path.
+// Middleware registered on the router runs before h and may stop the chain (e.g. for authentication).
+// h receives the original request and writes its own response, so no JSON response is sent by the context.
+func (this *Router) Mount(path string, h http.Handler) {
+	fn := handlerFunc(h)
+	path = strings.TrimSuffix(path, "/") + "/*filepath"
+	for _, method := range methods {
+		this.route(method, path, fn)
+	}
+}
+
+// Walk calls fn for every route registered on the router and its sub-routers, in registration order.
+// path is the full path of the route and handlers is the complete chain of middleware and route handlers.
+func (this *Router) Walk(fn func(method, path string, handlers []HandlerFunc)) {
+	for _, route := range this.root().routes {
+		if route.router.within(this) {
+			fn(route.method, route.fullPath(), route.chain())
+		}
+	}
+}
+
+// EnableRouteListing registers a GET route at path responding with a JSON array describing every route
+// registered on the root router and its sub-routers. The listing runs the router's middleware like any
+// other route, so it can be protected by e.g. registering it on a sub-router only available in development.
+func (this *Router) EnableRouteListing(path string) *Route {
+	type routeInfo struct {
+		Method          string `json:"method"`
+		Path            string `json:"path"`
+		HandlerCount    int    `json:"handlerCount"`
+		MiddlewareCount int    `json:"middlewareCount"`
+	}
+	return this.route("GET", path, func(c *Context) error {
+		routes := make([]*routeInfo, 0)
+		for _, route := range this.root().routes {
+			chain := route.chain()
+			routes = append(routes, &routeInfo{
+				Method:          route.method,
+				Path:            route.fullPath(),
+				HandlerCount:    len(route.handlers),
+				MiddlewareCount: len(chain) - len(route.handlers),
+			})
+		}
+		c.Result = routes
+		return nil
+	})
+}
+
+// NotFound sets the handlers run for requests that don't match any route.
+// The handlers run through the normal context pipeline, so returning ErrNotFound results in a JSON 404 response.
+// Unlike for matched routes, Errors without a message are sent with a body as well, e.g. {"statusCode":404}.
+func (this *Router) NotFound(fns ...HandlerFunc) {
+	this.root().notFound = fns
+}
+
+// MethodNotAllowed sets the handlers run for requests whose path matches a route registered for
+// another method. The Allow header is set to the registered methods before the handlers run.
+func (this *Router) MethodNotAllowed(fns ...HandlerFunc) {
+	this.root().methodNotAllowed = fns
+}
 
 func (this *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	this.r.ServeHTTP(w, r)
+	root := this.root()
+	if root.MethodOverride && r.Method == "POST" {
+		if method := r.Header.Get("X-HTTP-Method-Override"); method != "" {
+			r = r.WithContext(context.WithValue(r.Context(), originalMethodKey, r.Method))
+			r.Method = strings.ToUpper(method)
+		}
+	}
+	for _, host := range root.hosts {
+		if host.matchHost(r.Host) {
+			if handle, p := host.r.Lookup(r.Method, r.URL.Path); handle != nil {
+				handle(w, r, p)
+				return
+			}
+		}
+	}
+	this.router().ServeHTTP(w, r)
+}
+
+// matchHost reports whether host, with any port removed, matches the router's host pattern.
+func (this *Router) matchHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	if strings.HasPrefix(this.host, "*.") {
+		return strings.HasSuffix(host, this.host[1:])
+	} else {
+		return host == this.host
+	}
+}
+
+// Use adds middleware to the router. Middleware is resolved when a request is served, so it applies to
+// all routes of the router and its sub-routers, whether they were registered before or after the call to Use.
+// Middleware of parent routers runs first, followed by the router's own middleware and then the route handlers.
+func (this *Router) Use(middleware ...HandlerFunc) {
+	this.mw = append(this.mw, middleware...)
+}
+
+// Chain composes fns into a reusable middleware stack, preserving their order.
+// The stack can be registered on any number of routers with r.Use(stack...).
+func Chain(fns ...HandlerFunc) []HandlerFunc {
+	return append([]HandlerFunc(nil), fns...)
 }
 
-func (this *Router) Use(middleware HandlerFunc) {
-	this.mw = append(this.mw, middleware)
+func (this *Route) fullPath() string {
+	return this.router.fullPath() + this.path
+}
+
+// SkipMiddleware makes the route skip all middleware registered on its router and the router's parents.
+// Only the handlers passed when registering the route are run.
+func (this *Route) SkipMiddleware() *Route {
+	this.skipMw = true
+	return this
+}
+
+// Timeout sets the time the route's handlers may take, overriding the Timeout of the router.
+func (this *Route) Timeout(d time.Duration) *Route {
+	this.timeout = d
+	return this
+}
+
+func (this *Route) timeoutDuration() time.Duration {
+	if this.timeout > 0 {
+		return this.timeout
+	} else {
+		return this.router.timeout()
+	}
+}
+
+// Deprecated marks the route as deprecated, see Router.Deprecated.
+func (this *Route) Deprecated(sunset time.Time, link string) *Route {
+	this.deprecation = &deprecation{sunset: sunset, link: link}
+	return this
+}
+
+func (this *Route) deprecated() *deprecation {
+	if this.deprecation != nil {
+		return this.deprecation
+	} else {
+		return this.router.deprecated()
+	}
+}
+
+// StreamBody marks the route as streaming its request body, keeping Context.RawBody from buffering it.
+func (this *Route) StreamBody() *Route {
+	this.streamBody = true
+	return this
+}
+
+// chain returns the route's handlers preceded by the current middleware of its router.
+func (this *Route) chain() []HandlerFunc {
+	if this.skipMw {
+		return this.handlers
+	}
+	fns := this.router.middleware()
+	fns = append(fns, this.handlers...)
+	return fns
+}
+
+// register adds the route to the routing tree of its router.
+func (this *Route) register() {
+	defer func() {
+		if v := recover(); v != nil {
+			this.panicf("%v", v)
+		}
+	}()
+	this.router.router().Handle(this.method, this.fullPath(), this.router.wrap(this))
+}
+
+// panicf panics with a message identifying the route and where it was registered.
+func (this *Route) panicf(format string, args ...interface{}) {
+	panic(fmt.Sprintf("milk: invalid route %s %s registered at %s: %s",
+		this.method, this.fullPath(), this.source, fmt.Sprintf(format, args...)))
+}
+
+// caller returns the file:line of the nearest caller outside the package.
+func caller() string {
+	pcs := make([]uintptr, 16)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, pkgPath+".") || strings.HasSuffix(frame.File, "_test.go") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown location"
+		}
+	}
+}
+
+// wrap returns a Handle running the handlers of the route through the context pipeline.
+func (this *Router) wrap(route *Route) Handle {
+	return func(w http.ResponseWriter, r *http.Request, p PathParams) {
+		this.serve(w, r, p, route, route.chain())
+	}
+}
+
+// fallback returns the handler for requests that don't match any route, running the handlers returned by
+// the handlers func. Unless NotFoundMiddleware is set and there are no handlers, an empty 404 response is sent.
+func (this *Router) fallback(handlers func() []HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fns := handlers()
+		if this.NotFoundMiddleware {
+			if len(fns) == 0 {
+				fns = []HandlerFunc{func(c *Context) error { return ErrNotFound }}
+			}
+			fns = append(this.middleware(), fns...)
+		}
+		if len(fns) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		this.serve(w, r, nil, nil, fns)
+	})
+}
+
+// options returns the handler for OPTIONS requests to paths without an OPTIONS route, whose Allow header
+// has been set by the backend. The router's middleware runs first, e.g. CORSPreflight answering CORS preflight
+// requests. If no middleware answers the request, an empty 200 response is sent.
+func (this *Router) options() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fns := append(this.middleware(), func(c *Context) error {
+			c.W.WriteHeader(http.StatusOK)
+			return nil
+		})
+		this.serve(w, r, nil, nil, fns)
+	})
+}
+
+// serve runs handlers through the context pipeline for the request and sends the response.
+// route is the route matched by the request, or nil for requests not matching any route.
+func (this *Router) serve(w http.ResponseWriter, r *http.Request, p PathParams, route *Route, handlers []HandlerFunc) {
+	c, err := this.createContext(r)
+	if err != nil {
+		c = r.Context()
+	}
+	c, cancel := cancelWithRequest(c, r)
+	defer cancel()
+	context := newContext(this, c, r, w, p, handlers)
+	defer context.release()
+	defer func() {
+		if !context.detached {
+			context.finish()
+		}
+	}()
+	timeout := this.timeout()
+	if route != nil {
+		context.pattern = route.fullPath()
+		context.streamBody = route.streamBody
+		context.jsonp = route.jsonpEnabled()
+		timeout = route.timeoutDuration()
+		if d := route.deprecated(); d != nil {
+			// set before the handlers run, so the headers are sent with any response
+			d.setHeaders(w.Header())
+		}
+	}
+	if err != nil {
+		context.Errorf("error creating context: %v", err)
+		context.fail(fmt.Errorf("error creating context: %v", err))
+	} else if timeout > 0 {
+		if !this.runTimeout(context, timeout) {
+			// the handlers are still running, and finish the context once they return
+			return
+		}
+	} else {
+		this.run(context)
+	}
+	// Create and send response
+	context.respond()
+}
+
+// cancelWithRequest returns a copy of ctx that is also cancelled when the request's context is, i.e. when
+// the client disconnects, so handlers stop working for clients that are gone.
+func cancelWithRequest(ctx context.Context, r *http.Request) (context.Context, context.CancelFunc) {
+	reqDone := r.Context().Done()
+	if ctx == r.Context() || reqDone == nil {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-reqDone:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// run fires off the first handler of the context, recovering from any panic in the handlers.
+// A recovered panic is logged with its stack trace and recorded as an internal server error on the context.
+func (this *Router) run(c *Context) {
+	defer func() {
+		if v := recover(); v != nil {
+			c.Errorf("panic serving %s %s: %v\n%s", c.R.Method, c.R.URL.Path, v, debug.Stack())
+			c.fail(newPanicError(v))
+			c.Stop()
+			if fn := this.panicHandler(); fn != nil {
+				fn(c, v)
+			}
+		}
+	}()
+	// Fire off the first handler by calling Next(). Next then calls itself recursively
+	c.Next()
+}
+
+// runTimeout runs the handlers of the context in a separate goroutine with a context cancelled after timeout.
+// If the timeout fires before the handlers have finished, a 503 response is sent and the response writer
+// is closed for any later writes by the handlers. The context is then detached: the serving goroutine must not
+// use it any more, and the handler goroutine reports ErrTimeout to the OnError hooks and finishes the context
+// once the handlers return. Returns false if the timeout fired.
+func (this *Router) runTimeout(c *Context, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(c.Context, timeout)
+	defer cancel()
+	c.Context = ctx
+	// created up front, as logging the timeout mustn't race with the handlers creating the logger
+	logger := c.log()
+	c.w.setDeadline(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		this.run(c)
+	}()
+	expired := false
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// if the client is gone rather than the timeout having fired, the handlers are waited for as usual
+		expired = ctx.Err() == context.DeadlineExceeded
+	}
+	if expired {
+		select {
+		case <-done:
+			// the handlers returned just as the timeout fired
+			expired = false
+		default:
+		}
+	}
+	if !expired {
+		<-done
+		c.w.setDeadline(nil)
+		return true
+	}
+	c.detached = true
+	logger.Errorf("timeout serving %s %s after %v", c.R.Method, c.R.URL.Path, timeout)
+	c.w.timeout()
+	go func() {
+		<-done
+		c.fail(ErrTimeout)
+		c.reportError(c.fatalErr())
+		c.finish()
+	}()
+	return false
 }
 
-func wrap(createContext CreateContextFn, handlers ...HandlerFunc) httprouter.Handle {
-	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		c := createContext(r)
-		context := newContext(c, r, w, p, handlers)
-		// Fire off the first handler by calling Next(). Next then calls itself recursively
-		context.Next()
-		// Create and send response
-		context.respond()
+// handlerFunc adapts a http.Handler to a HandlerFunc. The response is marked as written after
+// h has been served, keeping the context from sending a response of its own.
+func handlerFunc(h http.Handler) HandlerFunc {
+	return func(c *Context) error {
+		h.ServeHTTP(c.W, c.R)
+		c.w.markWritten()
+		return nil
 	}
 }
@@ -0,0 +1,1045 @@
+package milk
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serveRequest serves a request with the given method, url, body and header name/value pairs with h.
+func serveRequest(h http.Handler, method, url string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, url, body)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// newTestRouter returns a router logging to a RecordingLogger instead of the standard logger.
+func newTestRouter() (*Router, *RecordingLogger) {
+	logger := &RecordingLogger{}
+	r := NewRouter()
+	r.NewLogger = func(c *Context) Logger { return logger }
+	return r, logger
+}
+
+func TestTimeoutHandlersFinishingInTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		setup  func(r *Router)
+		url    string
+		status int
+		body   string
+	}{
+		{
+			name: "route timeout",
+			setup: func(r *Router) {
+				r.Get("/x", func(c *Context) error { c.Result = "ok"; return nil }).Timeout(time.Second)
+			},
+			url: "/x", status: 200, body: `"ok"`,
+		},
+		{
+			name: "router timeout",
+			setup: func(r *Router) {
+				r.Timeout = time.Second
+				r.Get("/x", func(c *Context) error { c.Result = "ok"; return nil })
+			},
+			url: "/x", status: 200, body: `"ok"`,
+		},
+		{
+			name: "router timeout with error",
+			setup: func(r *Router) {
+				r.Timeout = time.Second
+				r.Get("/x", func(c *Context) error { return ErrConflict })
+			},
+			url: "/x", status: 409,
+		},
+		{
+			name: "router timeout for requests not matching any route",
+			setup: func(r *Router) {
+				r.Timeout = time.Second
+				r.NotFound(func(c *Context) error { return ErrNotFound })
+			},
+			url: "/missing", status: 404,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			test.setup(r)
+			w := serveRequest(r, "GET", test.url, nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if test.body != "" && strings.TrimSpace(w.Body.String()) != test.body {
+				t.Errorf("expected body %s, got %s", test.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDefaultTimeout(t *testing.T) {
+	defer func(d time.Duration) { DefaultTimeout = d }(DefaultTimeout)
+	DefaultTimeout = 55 * time.Second
+
+	r, _ := newTestRouter()
+	r.Get("/x", func(c *Context) error {
+		if _, ok := c.Deadline(); !ok {
+			t.Error("expected the context to have a deadline")
+		}
+		c.Result = "ok"
+		return nil
+	})
+	if w := serveRequest(r, "GET", "/x", nil); w.Code != 200 {
+		t.Errorf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serveRequest(r, "GET", "/missing", nil); w.Code != 404 {
+		t.Errorf("expected status 404, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTimeoutExpired(t *testing.T) {
+	r, logger := newTestRouter()
+	var mu sync.Mutex
+	var reported []error
+	finished := make(chan struct{})
+	r.OnError(func(c *Context, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	})
+	r.OnFinish(func(c *Context) { close(finished) })
+	release := make(chan struct{})
+	r.Get("/slow", func(c *Context) error {
+		<-c.Done()
+		<-release
+		// the late handler keeps using the context after the timeout response has been sent
+		c.Result = "too late"
+		c.W.Header().Set("X-Late", "1")
+		c.W.Write([]byte("too late"))
+		return errors.New("late failure")
+	}).Timeout(10 * time.Millisecond)
+
+	w := serveRequest(r, "GET", "/slow", nil)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, "Request timed out") {
+		t.Errorf("expected the timeout payload, got %s", body)
+	}
+
+	close(release)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("the context wasn't finished after the handlers returned")
+	}
+	if w.Header().Get("X-Late") != "" || strings.Contains(w.Body.String(), "too late") {
+		t.Error("the late handler changed the response")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 || !errors.Is(reported[0], ErrTimeout) {
+		t.Errorf("expected ErrTimeout to be reported, got %v", reported)
+	}
+	var logged bool
+	for _, entry := range logger.Entries() {
+		logged = logged || strings.Contains(entry.Message, "timeout serving GET /slow")
+	}
+	if !logged {
+		t.Errorf("expected the timeout to be logged, got %v", logger.Entries())
+	}
+}
+
+// TestTimeoutHeaders sets headers while the timeout fires. Run with -race to check that the timeout response
+// doesn't share its header map with the handlers.
+func TestTimeoutHeaders(t *testing.T) {
+	r, _ := newTestRouter()
+	r.Use(func(c *Context) error {
+		c.SetHeader("X-Before", "1")
+		return nil
+	})
+	r.Get("/slow", func(c *Context) error {
+		for i := 0; c.Context.Err() == nil; i++ {
+			c.SetHeader("X-Count", strconv.Itoa(i))
+		}
+		return nil
+	}).Timeout(time.Millisecond)
+	r.Get("/fast", func(c *Context) error {
+		c.W.Header().Del("X-Before")
+		c.SetHeader("X-Fast", "1")
+		c.Result = "ok"
+		return nil
+	}).Timeout(time.Second)
+
+	for i := 0; i < 20; i++ {
+		w := serveRequest(r, "GET", "/slow", nil)
+		if w.Code != http.StatusServiceUnavailable || w.Header().Get("X-Count") != "" {
+			t.Fatalf("expected a 503 response without the handler's headers, got %d %v", w.Code, w.Header())
+		}
+	}
+	w := serveRequest(r, "GET", "/fast", nil)
+	if w.Code != 200 || w.Header().Get("X-Fast") != "1" || w.Header().Get("X-Before") != "" {
+		t.Errorf("expected the handler's headers in the response, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestNotFoundHandlers(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+		body   string
+		allow  string
+	}{
+		{name: "not found", method: "GET", url: "/missing", status: 404, body: `{"statusCode":404}`},
+		{name: "method not allowed", method: "DELETE", url: "/x", status: 405, body: `{"statusCode":405}`, allow: "GET, OPTIONS"},
+		{name: "matched route keeps an empty body", method: "GET", url: "/x", status: 404, body: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Get("/x", func(c *Context) error { return ErrNotFound })
+			r.NotFound(func(c *Context) error { return ErrNotFound })
+			r.MethodNotAllowed(func(c *Context) error { return NewError(http.StatusMethodNotAllowed, "") })
+			w := serveRequest(r, test.method, test.url, nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.body {
+				t.Errorf("expected body %q, got %q", test.body, body)
+			}
+			if allow := w.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("expected Allow header %q, got %q", test.allow, allow)
+			}
+		})
+	}
+}
+
+// record returns a handler appending name to *calls.
+func record(calls *[]string, name string) HandlerFunc {
+	return func(c *Context) error {
+		*calls = append(*calls, name)
+		return nil
+	}
+}
+
+func TestRouteMethods(t *testing.T) {
+	tests := []struct {
+		method   string
+		register func(r *Router, path string, fns ...HandlerFunc) *Route
+	}{
+		{"GET", (*Router).Get},
+		{"HEAD", (*Router).Head},
+		{"POST", (*Router).Post},
+		{"PUT", (*Router).Put},
+		{"PATCH", (*Router).Patch},
+		{"DELETE", (*Router).Delete},
+		{"OPTIONS", (*Router).Options},
+	}
+	for _, test := range tests {
+		t.Run(test.method, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var calls []string
+			r.Use(record(&calls, "parent"))
+			sub := r.SubRouter("/items")
+			sub.Use(record(&calls, "child"))
+			test.register(sub, "/:id", record(&calls, "handler"), func(c *Context) error {
+				c.Result = c.R.Method + " " + c.Params.Get("id")
+				return nil
+			})
+			w := serveRequest(r, test.method, "/items/1", nil)
+			if w.Code != 200 {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if strings.Join(calls, ",") != "parent,child,handler" {
+				t.Errorf("expected the parent and child middleware and the handler to run, got %v", calls)
+			}
+			body := `"` + test.method + ` 1"`
+			if test.method == "HEAD" {
+				body = ""
+			}
+			if strings.TrimSpace(w.Body.String()) != body {
+				t.Errorf("expected body %s, got %s", body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMount(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		token  string
+		status int
+		body   string
+	}{
+		{name: "authorized", method: "GET", url: "/debug/vars", token: "secret", status: 200, body: "GET /debug/vars"},
+		{name: "other method", method: "POST", url: "/debug/a/b", token: "secret", status: 200, body: "POST /debug/a/b"},
+		{name: "stopped by middleware", method: "GET", url: "/debug/vars", status: 403},
+		{name: "outside the subtree", method: "GET", url: "/other", token: "secret", status: 404},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Use(func(c *Context) error {
+				if c.R.Header.Get("X-Token") != "secret" {
+					return ErrForbidden
+				}
+				return nil
+			})
+			r.Mount("/debug", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte(r.Method + " " + r.URL.Path))
+			}))
+			w := serveRequest(r, test.method, test.url, nil, "X-Token", test.token)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d: %s", test.status, w.Code, w.Body.String())
+			}
+			if test.body != "" && w.Body.String() != test.body {
+				t.Errorf("expected the mounted handler to write %q, got %q", test.body, w.Body.String())
+			}
+		})
+	}
+}
+
+type ctxKey string
+
+func TestMountRouter(t *testing.T) {
+	var calls []string
+	root, _ := newTestRouter()
+	root.Use(record(&calls, "root"))
+
+	billing := NewRouter()
+	billing.Use(record(&calls, "billing"))
+	billing.CreateContext = func(r *http.Request) context.Context {
+		return context.WithValue(context.Background(), ctxKey("team"), "billing")
+	}
+	invoices := NewRouter()
+	invoices.Use(record(&calls, "invoices"))
+	invoices.Get("/:invoiceID", func(c *Context) error {
+		c.Result = []interface{}{c.Params.Get("orgID"), c.Params.Get("invoiceID"), c.Value(ctxKey("team"))}
+		return nil
+	})
+	billing.MountRouter("/:orgID/invoices", invoices)
+	root.MountRouter("/billing", billing)
+	// routes registered after mounting are served as well
+	billing.Get("/:orgID/status", func(c *Context) error { c.Result = "ok"; return nil })
+
+	tests := []struct {
+		url   string
+		body  string
+		calls string
+	}{
+		{url: "/billing/acme/invoices/7", body: `["acme","7","billing"]`, calls: "root,billing,invoices"},
+		{url: "/billing/acme/status", body: `"ok"`, calls: "root,billing"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			calls = nil
+			w := serveRequest(root, "GET", test.url, nil)
+			if w.Code != 200 {
+				t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.body {
+				t.Errorf("expected body %s, got %s", test.body, body)
+			}
+			if strings.Join(calls, ",") != test.calls {
+				t.Errorf("expected middleware %s to run, got %v", test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	r, _ := newTestRouter()
+	noop := func(c *Context) error { return nil }
+	r.Use(noop)
+	r.Get("/a", noop)
+	api := r.SubRouter("/api")
+	api.Use(noop, noop)
+	api.Post("/b", noop, noop)
+	api.Get("/c", noop).SkipMiddleware()
+	r.Delete("/d", noop)
+
+	tests := []struct {
+		name   string
+		router *Router
+		want   []string
+	}{
+		{name: "root", router: r, want: []string{"GET /a 2", "POST /api/b 5", "GET /api/c 1", "DELETE /d 2"}},
+		{name: "sub-router", router: api, want: []string{"POST /api/b 5", "GET /api/c 1"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			test.router.Walk(func(method, path string, handlers []HandlerFunc) {
+				got = append(got, method+" "+path+" "+strconv.Itoa(len(handlers)))
+			})
+			if strings.Join(got, "; ") != strings.Join(test.want, "; ") {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestHost(t *testing.T) {
+	r, _ := newTestRouter()
+	respond := func(s string) HandlerFunc { return func(c *Context) error { c.Result = s; return nil } }
+	r.Get("/users", respond("default"))
+	r.Get("/only-default", respond("default"))
+	r.Host("api.example.com").Get("/users", respond("api"))
+	r.Host("*.admin.example.com").Get("/users", respond("admin"))
+
+	tests := []struct {
+		host   string
+		url    string
+		status int
+		body   string
+	}{
+		{host: "api.example.com", url: "/users", status: 200, body: `"api"`},
+		{host: "API.example.com:8080", url: "/users", status: 200, body: `"api"`},
+		{host: "eu.admin.example.com", url: "/users", status: 200, body: `"admin"`},
+		{host: "admin.example.com", url: "/users", status: 200, body: `"default"`},
+		{host: "other.com", url: "/users", status: 200, body: `"default"`},
+		{host: "api.example.com", url: "/only-default", status: 200, body: `"default"`},
+		{host: "api.example.com", url: "/missing", status: 404},
+	}
+	for _, test := range tests {
+		t.Run(test.host+test.url, func(t *testing.T) {
+			req := httptest.NewRequest("GET", test.url, nil)
+			req.Host = test.host
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if test.body != "" && strings.TrimSpace(w.Body.String()) != test.body {
+				t.Errorf("expected body %s, got %s", test.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMethodOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		method   string
+		override string
+		body     string
+	}{
+		{name: "post overridden", enabled: true, method: "POST", override: "delete", body: `"DELETE from POST"`},
+		{name: "disabled", method: "POST", override: "DELETE", body: `"POST"`},
+		{name: "only post is overridden", enabled: true, method: "PUT", override: "DELETE", body: `"PUT"`},
+		{name: "no header", enabled: true, method: "POST", body: `"POST"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.MethodOverride = test.enabled
+			r.Delete("/x", func(c *Context) error {
+				c.Result = "DELETE from " + c.Values.GetString(KeyOriginalMethod)
+				return nil
+			})
+			for _, method := range []string{"POST", "PUT"} {
+				method := method
+				r.route(method, "/x", func(c *Context) error { c.Result = method; return nil })
+			}
+			w := serveRequest(r, test.method, "/x", nil, "X-HTTP-Method-Override", test.override)
+			if body := strings.TrimSpace(w.Body.String()); body != test.body {
+				t.Errorf("expected body %s, got %s", test.body, body)
+			}
+		})
+	}
+}
+
+func TestSkipMiddleware(t *testing.T) {
+	var calls []string
+	r, _ := newTestRouter()
+	r.Use(record(&calls, "root"))
+	admin := r.SubRouter("/admin")
+	admin.Use(func(c *Context) error { return ErrUnauthorized })
+	admin.Get("/login", record(&calls, "explicit"), record(&calls, "login")).SkipMiddleware()
+	admin.Get("/users", record(&calls, "users"))
+
+	tests := []struct {
+		url    string
+		status int
+		calls  string
+	}{
+		{url: "/admin/login", status: 200, calls: "explicit,login"},
+		{url: "/admin/users", status: 401, calls: "root"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			calls = nil
+			w := serveRequest(r, "GET", test.url, nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if strings.Join(calls, ",") != test.calls {
+				t.Errorf("expected %s to run, got %v", test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var calls []string
+	r, _ := newTestRouter()
+	ret := r.Group("/api", func(api *Router) {
+		api.Group("/v1", func(v1 *Router) {
+			v1.Group("/users", func(g *Router) {
+				g.Use(record(&calls, "users-mw"))
+				g.Get("", record(&calls, "users"))
+			}).Group("/orders", func(g *Router) {
+				g.Use(record(&calls, "orders-mw"))
+				g.Get("", record(&calls, "orders"))
+			})
+			v1.Get("/health", record(&calls, "health"))
+		})
+	})
+	if ret != r {
+		t.Error("expected Group to return the router itself")
+	}
+	tests := []struct {
+		url   string
+		calls string
+	}{
+		{url: "/api/v1/users", calls: "users-mw,users"},
+		{url: "/api/v1/orders", calls: "orders-mw,orders"},
+		{url: "/api/v1/health", calls: "health"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			calls = nil
+			if w := serveRequest(r, "GET", test.url, nil); w.Code != 200 {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			if strings.Join(calls, ",") != test.calls {
+				t.Errorf("expected %s to run, got %v", test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	var calls []string
+	r, _ := newTestRouter()
+	r.Use(record(&calls, "parent1"))
+	sub := r.SubRouter("/sub")
+	sub.Get("/x", record(&calls, "route"))
+	// registered after the route and after creating the sub-router
+	sub.Use(record(&calls, "child1"), record(&calls, "child2"))
+	r.Use(Chain(record(&calls, "parent2"), record(&calls, "parent3"))...)
+	r.Get("/y", record(&calls, "route"))
+
+	tests := []struct {
+		url   string
+		calls string
+	}{
+		{url: "/sub/x", calls: "parent1,parent2,parent3,child1,child2,route"},
+		{url: "/y", calls: "parent1,parent2,parent3,route"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			calls = nil
+			serveRequest(r, "GET", test.url, nil)
+			if strings.Join(calls, ",") != test.calls {
+				t.Errorf("expected %s, got %v", test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+	stack := Chain(record(&calls, "a"), record(&calls, "b"))
+	stack2 := append(stack, record(&calls, "c"))
+	r1, _ := newTestRouter()
+	r1.Use(stack...)
+	r1.Get("/", record(&calls, "handler"))
+	r2, _ := newTestRouter()
+	r2.Use(stack2...)
+	r2.Get("/", record(&calls, "handler"))
+
+	tests := []struct {
+		name   string
+		router *Router
+		calls  string
+	}{
+		{name: "stack", router: r1, calls: "a,b,handler"},
+		{name: "extended stack", router: r2, calls: "a,b,c,handler"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls = nil
+			serveRequest(test.router, "GET", "/", nil)
+			if strings.Join(calls, ",") != test.calls {
+				t.Errorf("expected %s, got %v", test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestRouterOptions(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []RouterOption
+		method string
+		url    string
+		status int
+	}{
+		{name: "trailing slash redirected by default", method: "POST", url: "/users/", status: http.StatusTemporaryRedirect},
+		{name: "trailing slash not redirected", opts: []RouterOption{WithRedirectTrailingSlash(false)}, method: "POST", url: "/users/", status: 404},
+		{name: "fixed path redirected by default", opts: []RouterOption{WithRedirectTrailingSlash(false)}, method: "POST", url: "/USERS", status: http.StatusTemporaryRedirect},
+		{name: "fixed path not redirected", opts: []RouterOption{WithRedirectFixedPath(false)}, method: "POST", url: "/USERS", status: 404},
+		{name: "method not allowed", method: "PUT", url: "/users", status: 405},
+		{name: "method not allowed disabled", opts: []RouterOption{WithHandleMethodNotAllowed(false)}, method: "PUT", url: "/users", status: 404},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewRouter(test.opts...)
+			r.NewLogger = func(c *Context) Logger { return &RecordingLogger{} }
+			r.Post("/users", func(c *Context) error { return nil })
+			r.MethodNotAllowed(func(c *Context) error { return NewError(http.StatusMethodNotAllowed, "") })
+			if w := serveRequest(r, test.method, test.url, nil); w.Code != test.status {
+				t.Errorf("expected status %d, got %d", test.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestNotFoundMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		enabled    bool
+		notFound   bool // set a NotFound handler
+		method     string
+		status     int
+		middleware bool
+	}{
+		{name: "disabled", method: "GET", status: 404},
+		{name: "disabled with handler", notFound: true, method: "GET", status: 404},
+		{name: "not found", enabled: true, method: "GET", status: 404, middleware: true},
+		{name: "not found with handler", enabled: true, notFound: true, method: "GET", status: 404, middleware: true},
+		{name: "method not allowed", enabled: true, method: "POST", status: 404, middleware: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.NotFoundMiddleware = test.enabled
+			var ran bool
+			r.Use(func(c *Context) error {
+				ran = true
+				c.SetHeader("Access-Control-Allow-Origin", "*")
+				return nil
+			})
+			r.Get("/missing/x", func(c *Context) error { return nil })
+			if test.notFound {
+				r.NotFound(func(c *Context) error { return ErrNotFound })
+			}
+			url := "/missing"
+			if test.method == "POST" {
+				url = "/missing/x"
+			}
+			w := serveRequest(r, test.method, url, nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if ran != test.middleware || (w.Header().Get("Access-Control-Allow-Origin") != "") != test.middleware {
+				t.Errorf("expected middleware to run: %v, ran: %v", test.middleware, ran)
+			}
+		})
+	}
+}
+
+func TestCreateContextE(t *testing.T) {
+	tests := []struct {
+		name   string
+		create CreateContextEFn
+		status int
+		value  interface{}
+	}{
+		{
+			name: "created",
+			create: func(r *http.Request) (context.Context, error) {
+				return context.WithValue(context.Background(), ctxKey("name"), "created"), nil
+			},
+			status: 200, value: "created",
+		},
+		{
+			name:   "failing",
+			create: func(r *http.Request) (context.Context, error) { return nil, errors.New("metadata unavailable") },
+			status: 500,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			r.CreateContext = func(r *http.Request) context.Context {
+				return context.WithValue(context.Background(), ctxKey("name"), "ignored")
+			}
+			r.CreateContextE = test.create
+			var ran bool
+			var value interface{}
+			r.Get("/x", func(c *Context) error {
+				ran = true
+				value = c.Value(ctxKey("name"))
+				return nil
+			})
+			w := serveRequest(r, "GET", "/x", nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if test.status == 500 {
+				if ran {
+					t.Error("expected the handlers not to run")
+				}
+				if len(logger.Entries()) == 0 || !strings.Contains(logger.Entries()[0].Message, "metadata unavailable") {
+					t.Errorf("expected the error to be logged, got %v", logger.Entries())
+				}
+			} else if value != test.value {
+				t.Errorf("expected the context value %v, got %v", test.value, value)
+			}
+		})
+	}
+}
+
+func TestCreateContext(t *testing.T) {
+	withName := func(name string) CreateContextFn {
+		return func(r *http.Request) context.Context {
+			return context.WithValue(context.Background(), ctxKey("name"), name)
+		}
+	}
+	tests := []struct {
+		name   string
+		setup  func(root, mid, leaf *Router)
+		status int
+		value  interface{}
+	}{
+		{name: "root default", status: 200, value: nil},
+		{name: "root", setup: func(root, mid, leaf *Router) { root.CreateContext = withName("root") }, status: 200, value: "root"},
+		{name: "middle overrides root", setup: func(root, mid, leaf *Router) {
+			root.CreateContext, mid.CreateContext = withName("root"), withName("mid")
+		}, status: 200, value: "mid"},
+		{name: "leaf overrides all", setup: func(root, mid, leaf *Router) {
+			root.CreateContext, mid.CreateContext, leaf.CreateContext = withName("root"), withName("mid"), withName("leaf")
+		}, status: 200, value: "leaf"},
+		{name: "cleared leaf inherits", setup: func(root, mid, leaf *Router) {
+			mid.CreateContext, leaf.CreateContext = withName("mid"), withName("leaf")
+			leaf.ClearCreateContext()
+		}, status: 200, value: "mid"},
+		{name: "cleared root uses the request's context", setup: func(root, mid, leaf *Router) {
+			root.ClearCreateContext()
+		}, status: 200, value: "request"},
+		{name: "CreateContextE takes precedence", setup: func(root, mid, leaf *Router) {
+			mid.CreateContext = withName("mid")
+			mid.CreateContextE = func(r *http.Request) (context.Context, error) {
+				return context.WithValue(context.Background(), ctxKey("name"), "midE"), nil
+			}
+		}, status: 200, value: "midE"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root, _ := newTestRouter()
+			mid := root.SubRouter("/mid")
+			leaf := mid.SubRouter("/leaf")
+			if test.setup != nil {
+				test.setup(root, mid, leaf)
+			}
+			var ran bool
+			var value interface{}
+			leaf.Get("/x", func(c *Context) error {
+				ran = true
+				value = c.Value(ctxKey("name"))
+				return nil
+			})
+			req := httptest.NewRequest("GET", "/mid/leaf/x", nil)
+			req = req.WithContext(context.WithValue(req.Context(), ctxKey("name"), "request"))
+			w := httptest.NewRecorder()
+			root.ServeHTTP(w, req)
+			if w.Code != test.status || !ran {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if value != test.value {
+				t.Errorf("expected the context value %v, got %v", test.value, value)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	r, _ := newTestRouter()
+	handler := func(c *Context) error {
+		c.Result = c.APIVersion()
+		return nil
+	}
+	for _, v := range []string{"v1", "v2"} {
+		r.Version(v).Get("/users", handler)
+	}
+	r.Get("/users", handler)
+	tests := []struct {
+		url  string
+		body string
+	}{
+		{url: "/v1/users", body: `"v1"`},
+		{url: "/v2/users", body: `"v2"`},
+		{url: "/users", body: `""`},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			if body := strings.TrimSpace(serveRequest(r, "GET", test.url, nil).Body.String()); body != test.body {
+				t.Errorf("expected %s, got %s", test.body, body)
+			}
+		})
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	r, _ := newTestRouter()
+	var pattern string
+	r.Use(func(c *Context) error {
+		pattern = c.RoutePattern()
+		return nil
+	})
+	r.NotFoundMiddleware = true
+	r.SubRouter("/users").Get("/:id", func(c *Context) error { return nil })
+	r.Mount("/files", http.NotFoundHandler())
+	tests := []struct {
+		url     string
+		pattern string
+	}{
+		{url: "/users/99", pattern: "/users/:id"},
+		{url: "/files/a/b", pattern: "/files/*filepath"},
+		{url: "/missing", pattern: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			pattern = "unset"
+			serveRequest(r, "GET", test.url, nil)
+			if pattern != test.pattern {
+				t.Errorf("expected pattern %q, got %q", test.pattern, pattern)
+			}
+		})
+	}
+}
+
+func TestHandlerAdapter(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		status  int
+		handled bool
+	}{
+		{name: "allowed", token: "secret", status: 200, handled: true},
+		{name: "forbidden", status: 403},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Use(func(c *Context) error {
+				if c.GetHeader("X-Token") != "secret" {
+					return ErrForbidden
+				}
+				return nil
+			})
+			var handled bool
+			r.Handler("GET", "/metrics", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled = true
+				w.Write([]byte("metrics"))
+			}))
+			w := serveRequest(r, "GET", "/metrics", nil, "X-Token", test.token)
+			if w.Code != test.status || handled != test.handled {
+				t.Fatalf("expected status %d and handled %v, got %d and %v", test.status, test.handled, w.Code, handled)
+			}
+			if test.handled && w.Body.String() != "metrics" {
+				t.Errorf("expected only the handler's response, got %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouteValidation(t *testing.T) {
+	noop := func(c *Context) error { return nil }
+	tests := []struct {
+		name     string
+		register func(r *Router)
+		message  string
+	}{
+		{name: "conflict", register: func(r *Router) {
+			r.SubRouter("/api").Get("/users/:id", noop)
+			r.SubRouter("/api").Get("/users/:name", noop)
+		}, message: "milk: invalid route GET /api/users/:name registered at "},
+		{name: "missing slash", register: func(r *Router) {
+			r.SubRouter("/api").Get("users", noop)
+		}, message: "milk: invalid route GET /apiusers registered at "},
+		{name: "empty path", register: func(r *Router) { r.Get("", noop) }, message: "path is empty"},
+		{name: "no handlers", register: func(r *Router) { r.SubRouter("/api").Post("/x") }, message: "POST /api/x registered at "},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, test.message) {
+					t.Errorf("expected a panic containing %q, got %q", test.message, msg)
+				}
+				if !strings.Contains(msg, "router_test.go:") {
+					t.Errorf("expected the panic to name the registering line, got %q", msg)
+				}
+			}()
+			r, _ := newTestRouter()
+			test.register(r)
+		})
+	}
+}
+
+func TestRouteListing(t *testing.T) {
+	r, _ := newTestRouter()
+	noop := func(c *Context) error { return nil }
+	r.Use(noop)
+	dev := r.SubRouter("/_dev")
+	dev.Use(func(c *Context) error {
+		if c.GetHeader("X-Dev") == "" {
+			return ErrForbidden
+		}
+		return nil
+	})
+	dev.EnableRouteListing("/routes")
+	r.SubRouter("/api").Post("/users", noop, noop)
+
+	if w := serveRequest(r, "GET", "/_dev/routes", nil); w.Code != 403 {
+		t.Errorf("expected the listing to be protected by middleware, got %d", w.Code)
+	}
+	w := serveRequest(r, "GET", "/_dev/routes", nil, "X-Dev", "1")
+	want := `[{"method":"GET","path":"/_dev/routes","handlerCount":1,"middlewareCount":2},` +
+		`{"method":"POST","path":"/api/users","handlerCount":2,"middlewareCount":1}]`
+	if body := strings.TrimSpace(w.Body.String()); body != want {
+		t.Errorf("expected %s, got %s", want, body)
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	sunset := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	r, _ := newTestRouter()
+	v1 := r.SubRouter("/v1")
+	v1.Deprecated(sunset, "/v2/users")
+	v1.Get("/users", func(c *Context) error { return nil })
+	v1.Get("/fail", func(c *Context) error { return ErrConflict })
+	r.Get("/v2/users", func(c *Context) error { return nil })
+	r.Get("/old", func(c *Context) error { return nil }).Deprecated(time.Time{}, "")
+
+	tests := []struct {
+		url    string
+		status int
+		dep    string
+		sunset string
+		link   string
+	}{
+		{url: "/v1/users", status: 200, dep: "true", sunset: "Fri, 31 Jan 2025 00:00:00 GMT", link: `</v2/users>; rel="successor-version"`},
+		{url: "/v1/fail", status: 409, dep: "true", sunset: "Fri, 31 Jan 2025 00:00:00 GMT", link: `</v2/users>; rel="successor-version"`},
+		{url: "/v2/users", status: 200},
+		{url: "/old", status: 200, dep: "true"},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			w := serveRequest(r, "GET", test.url, nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			h := w.Header()
+			if h.Get("Deprecation") != test.dep || h.Get("Sunset") != test.sunset || h.Get("Link") != test.link {
+				t.Errorf("expected headers %q %q %q, got %q %q %q", test.dep, test.sunset, test.link,
+					h.Get("Deprecation"), h.Get("Sunset"), h.Get("Link"))
+			}
+		})
+	}
+}
+
+func TestOnError(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		status  int
+		report  bool
+	}{
+		{name: "success", handler: func(c *Context) error { return nil }, status: 200},
+		{name: "api error", handler: func(c *Context) error { return ErrNotFound }, status: 404, report: true},
+		{name: "internal error", handler: func(c *Context) error { return errors.New("db down") }, status: 500, report: true},
+		{name: "panic", handler: func(c *Context) error { panic("boom") }, status: 500, report: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			var reports []string
+			r.OnError(func(c *Context, err error) {
+				reports = append(reports, "root "+c.R.Method+" "+c.R.URL.Path+" "+strconv.Itoa(c.ResponseStatus()))
+			})
+			r.OnError(func(c *Context, err error) { panic("hook failed") })
+			sub := r.SubRouter("/sub")
+			sub.OnError(func(c *Context, err error) { reports = append(reports, "sub") })
+			sub.Get("/x", test.handler)
+			if w := serveRequest(r, "GET", "/sub/x", nil); w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			want := ""
+			if test.report {
+				want = "root GET /sub/x " + strconv.Itoa(test.status) + ",sub"
+			}
+			if strings.Join(reports, ",") != want {
+				t.Errorf("expected reports %q, got %q", want, reports)
+			}
+			var logged bool
+			for _, entry := range logger.Entries() {
+				logged = logged || strings.Contains(entry.Message, "hook failed")
+			}
+			if logged != test.report {
+				t.Errorf("expected the panicking hook to be recovered and logged: %v, got %v", test.report, logger.Entries())
+			}
+		})
+	}
+}
+
+func TestOnFinish(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler HandlerFunc
+		status  int
+		size    int64
+	}{
+		{name: "success", handler: func(c *Context) error { c.Result = "ok"; return nil }, status: 200, size: 5},
+		{name: "panic", handler: func(c *Context) error { panic("boom") }, status: 500, size: 53},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var calls []string
+			r.OnFinish(func(c *Context) {
+				calls = append(calls, "first "+strconv.Itoa(c.ResponseStatus())+" "+strconv.FormatInt(c.ResponseSize(), 10))
+			})
+			r.OnFinish(func(c *Context) { panic("hook failed") })
+			r.OnFinish(func(c *Context) { calls = append(calls, "second") })
+			r.Get("/x", func(c *Context) error {
+				c.Defer(func(c *Context) { calls = append(calls, "deferred") })
+				return nil
+			}, test.handler)
+			serveRequest(r, "GET", "/x", nil)
+			want := "deferred,first " + strconv.Itoa(test.status) + " " + strconv.FormatInt(test.size, 10) + ",second"
+			if strings.Join(calls, ",") != want {
+				t.Errorf("expected %s, got %v", want, calls)
+			}
+		})
+	}
+}
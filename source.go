@@ -0,0 +1,227 @@
+package milk
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// valueSource implements the typed accessors shared by Params, Headers and Cookies on top of a func looking up
+// the raw value of a key.
+type valueSource struct {
+	lookup      func(key string) (string, bool) // returns the key's value and whether it's present
+	dateFormats []string                        // layouts of dates, see layouts
+	plusSpaces  bool                            // spaces in times are unencoded '+', as in querystrings
+}
+
+// Headers provides typed access to the headers of a request, e.g. c.Headers().GetInt("X-Request-Depth").
+// Header names are canonicalized, so any casing may be used.
+type Headers struct {
+	valueSource
+}
+
+// Cookies provides typed access to the cookies of a request, e.g. c.Cookies().GetBool("beta").
+type Cookies struct {
+	valueSource
+}
+
+// Headers returns typed accessors for the headers of the request, sharing the implementation of Params.
+func (this *Context) Headers() Headers {
+	return Headers{valueSource{
+		lookup: func(key string) (string, bool) {
+			vals := this.R.Header.Values(key)
+			if len(vals) == 0 {
+				return "", false
+			}
+			return vals[0], true
+		},
+		dateFormats: this.Params.dateFormats,
+	}}
+}
+
+// Cookies returns typed accessors for the cookies of the request, sharing the implementation of Params.
+// Missing cookies result in zero values, like missing parameters.
+func (this *Context) Cookies() Cookies {
+	return Cookies{valueSource{
+		lookup: func(key string) (string, bool) {
+			cookie, err := this.R.Cookie(key)
+			if err != nil {
+				return "", false
+			}
+			return cookie.Value, true
+		},
+		dateFormats: this.Params.dateFormats,
+	}}
+}
+
+// Get returns the given key's value, or an empty string if it's missing.
+func (this valueSource) Get(key string) string {
+	val, _ := this.lookup(key)
+	return val
+}
+
+// Has reports whether the key is present, even without a value, like ?q= or ?includeDeleted.
+func (this valueSource) Has(key string) bool {
+	_, ok := this.lookup(key)
+	return ok
+}
+
+// GetStringDefault is like Get, but returns def if the key is missing or empty.
+func (this valueSource) GetStringDefault(key string, def string) string {
+	if val := this.Get(key); val != "" {
+		return val
+	}
+	return def
+}
+
+// GetInt returns the given key's value as an int.
+// Returns 0 for invalid or missing values.
+func (this valueSource) GetInt(key string) int {
+	val, _ := this.GetIntE(key)
+	return val
+}
+
+// GetIntDefault is like GetInt, but returns def if the key is missing or empty. Invalid values still result in 0,
+// so ?limit=0 and ?limit=banana don't get the default; use GetIntE to tell them apart.
+func (this valueSource) GetIntDefault(key string, def int) int {
+	val, err := this.GetIntE(key)
+	if err == ErrParamMissing {
+		return def
+	}
+	return val
+}
+
+// GetIntE is like GetInt, but returns ErrParamMissing for missing values and the parse error for invalid values.
+func (this valueSource) GetIntE(key string) (int, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return 0, ErrParamMissing
+	}
+	return strconv.Atoi(strVal)
+}
+
+// GetInt64 returns the given key's value as an int64.
+// Returns 0 for invalid or missing values.
+func (this valueSource) GetInt64(key string) int64 {
+	val, _ := this.GetInt64E(key)
+	return val
+}
+
+// GetInt64Default is like GetInt64, but returns def if the key is missing or empty. Invalid values still result in 0.
+func (this valueSource) GetInt64Default(key string, def int64) int64 {
+	val, err := this.GetInt64E(key)
+	if err == ErrParamMissing {
+		return def
+	}
+	return val
+}
+
+// GetInt64E is like GetInt64, but returns ErrParamMissing for missing values and the parse error for invalid values.
+func (this valueSource) GetInt64E(key string) (int64, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return 0, ErrParamMissing
+	}
+	val, err := strconv.ParseInt(strVal, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return val, nil
+}
+
+// GetFloat64 returns the given key's value as a float64. Exponent notation like 1.5e3 is accepted.
+// Returns 0 for invalid or missing values, including NaN and infinite values.
+func (this valueSource) GetFloat64(key string) float64 {
+	val, _ := this.GetFloat64E(key)
+	return val
+}
+
+// GetFloat64E is like GetFloat64, but returns ErrParamMissing for missing values and an error for invalid values.
+func (this valueSource) GetFloat64E(key string) (float64, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return 0, ErrParamMissing
+	}
+	f, err := strconv.ParseFloat(strVal, 64)
+	if err != nil {
+		return 0, err
+	} else if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("milk: %s is not a finite number", key)
+	}
+	return f, nil
+}
+
+// GetBool returns the given key's value as a bool, accepting the values of strconv.ParseBool
+// ("1", "t", "T", "TRUE", "true", "True" and their false counterparts). A key present without a value,
+// like ?includeDeleted, is true. Returns false for invalid or missing values.
+func (this valueSource) GetBool(key string) bool {
+	return this.GetBoolDefault(key, false)
+}
+
+// GetBoolDefault is like GetBool, but returns def if the key is missing.
+func (this valueSource) GetBoolDefault(key string, def bool) bool {
+	if strVal := this.Get(key); strVal != "" {
+		b, _ := strconv.ParseBool(strVal)
+		return b
+	} else if this.Has(key) {
+		return true
+	}
+	return def
+}
+
+// GetTime returns the given key's value as a time.Time, parsed by the first of the given layouts, time.RFC3339
+// and the date formats that matches the value. Returns the zero value for invalid or missing values.
+func (this valueSource) GetTime(key string, layouts ...string) time.Time {
+	t, _ := this.GetTimeE(key, layouts...)
+	return t
+}
+
+// GetTimeE is like GetTime, but returns ErrParamMissing for missing values and the parse error of the
+// last layout tried for invalid values, e.g. for responding with a ValidationError with ErrCodeSyntaxError.
+// For Params, values matching none of the layouts are retried with their spaces taken to be unencoded '+' of a
+// time zone offset, as in ?t=2021-06-01T10:00:00+02:00.
+func (this valueSource) GetTimeE(key string, layouts ...string) (time.Time, error) {
+	return this.parseTime(key, time.UTC, layouts)
+}
+
+// parseTime parses the given key's value in loc by the first of the layouts, time.RFC3339 and the date formats
+// that matches it.
+func (this valueSource) parseTime(key string, loc *time.Location, layouts []string) (time.Time, error) {
+	strVal := this.Get(key)
+	if strVal == "" {
+		return time.Time{}, ErrParamMissing
+	}
+	layouts = append(append([]string(nil), layouts...), time.RFC3339)
+	layouts = append(layouts, this.layouts()...)
+	t, err := parseLayouts(strVal, loc, layouts)
+	if err != nil && this.plusSpaces && strings.Contains(strVal, " ") {
+		// only a retry, as the spaces may as well belong to the layout, e.g. "2006-01-02 15:04"
+		if t, plusErr := parseLayouts(strings.Replace(strVal, " ", "+", -1), loc, layouts); plusErr == nil {
+			return t, nil
+		}
+	}
+	return t, err
+}
+
+// parseLayouts parses value in loc by the first of the layouts that matches it, returning the parse error of the
+// last layout otherwise.
+func parseLayouts(value string, loc *time.Location, layouts []string) (time.Time, error) {
+	var err error
+	for _, layout := range layouts {
+		var t time.Time
+		if t, err = time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// layouts returns the date formats of the source, or the DateFormat variable if it has none.
+func (this valueSource) layouts() []string {
+	if len(this.dateFormats) > 0 {
+		return this.dateFormats
+	}
+	return []string{DateFormat}
+}
@@ -0,0 +1,72 @@
+package milk
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHeadersAndCookies(t *testing.T) {
+	tests := []struct {
+		name string
+		read func(c *Context) interface{}
+		want string
+	}{
+		{name: "header in any casing", read: func(c *Context) interface{} { return c.Headers().GetInt("x-request-depth") }, want: "3"},
+		{name: "header canonical", read: func(c *Context) interface{} { return c.Headers().Get("X-Request-Depth") }, want: "3"},
+		{name: "repeated header", read: func(c *Context) interface{} { return c.Headers().Get("X-Tag") }, want: "a"},
+		{name: "missing header", read: func(c *Context) interface{} { return c.Headers().GetIntDefault("X-Missing", 5) }, want: "5"},
+		{
+			name: "missing header error",
+			read: func(c *Context) interface{} {
+				_, err := c.Headers().GetInt64E("X-Missing")
+				return err == ErrParamMissing
+			},
+			want: "true",
+		},
+		{name: "header has", read: func(c *Context) interface{} { return c.Headers().Has("x-empty") }, want: "true"},
+		{name: "header bool", read: func(c *Context) interface{} { return c.Headers().GetBool("X-Debug") }, want: "true"},
+		{
+			name: "header time",
+			read: func(c *Context) interface{} {
+				return c.Headers().GetTime("X-Since", http.TimeFormat).Format(time.RFC3339)
+			},
+			want: "2021-06-01T10:00:00Z",
+		},
+		{name: "cookie", read: func(c *Context) interface{} { return c.Cookies().GetFloat64("ratio") }, want: "0.5"},
+		{name: "cookie bool", read: func(c *Context) interface{} { return c.Cookies().GetBool("beta") }, want: "true"},
+		{name: "cookie case-sensitive", read: func(c *Context) interface{} { return c.Cookies().Has("Beta") }, want: "false"},
+		{name: "missing cookie", read: func(c *Context) interface{} { return c.Cookies().GetStringDefault("theme", "light") }, want: "light"},
+		{name: "missing cookie int", read: func(c *Context) interface{} { return c.Cookies().GetInt("theme") }, want: "0"},
+		{
+			name: "invalid cookie",
+			read: func(c *Context) interface{} {
+				_, err := c.Cookies().GetIntE("beta")
+				return err != nil && err != ErrParamMissing
+			},
+			want: "true",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			var got interface{}
+			r.Get("/x", func(c *Context) error { got = test.read(c); return nil })
+			req := httptest.NewRequest("GET", "/x", nil)
+			req.Header.Set("X-Request-Depth", "3")
+			req.Header.Add("X-Tag", "a")
+			req.Header.Add("X-Tag", "b")
+			req.Header.Set("X-Empty", "")
+			req.Header.Set("X-Debug", "1")
+			req.Header.Set("X-Since", "Tue, 01 Jun 2021 10:00:00 GMT")
+			req.AddCookie(&http.Cookie{Name: "ratio", Value: "0.5"})
+			req.AddCookie(&http.Cookie{Name: "beta", Value: "true"})
+			r.ServeHTTP(httptest.NewRecorder(), req)
+			if s := fmt.Sprint(got); s != test.want {
+				t.Errorf("expected %s, got %s", test.want, s)
+			}
+		})
+	}
+}
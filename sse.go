@@ -0,0 +1,55 @@
+package milk
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// EventStream sends Server-Sent Events to the client. It is created by Context.SSE.
+type EventStream struct {
+	c *Context
+}
+
+// SSE starts a Server-Sent Events response, writing the text/event-stream headers immediately.
+// Returns an error if the underlying response writer doesn't support flushing.
+func (this *Context) SSE() (*EventStream, error) {
+	if _, ok := this.w.w.(http.Flusher); !ok {
+		return nil, errors.New("milk: response writer does not support flushing")
+	}
+	h := this.W.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	this.W.WriteHeader(http.StatusOK)
+	this.w.Flush()
+	return &EventStream{c: this}, nil
+}
+
+// Send sends an event with data encoded as JSON and flushes it to the client.
+// The event type and id are omitted when empty.
+func (this *EventStream) Send(event, id string, data interface{}) error {
+	b, err := Marshal(data)
+	if err != nil {
+		return err
+	}
+	var buf strings.Builder
+	if id != "" {
+		fmt.Fprintf(&buf, "id: %s\n", id)
+	}
+	if event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", event)
+	}
+	fmt.Fprintf(&buf, "data: %s\n\n", b)
+	if _, err := this.c.W.Write([]byte(buf.String())); err != nil {
+		return err
+	}
+	this.c.w.Flush()
+	return nil
+}
+
+// Done returns a channel that is closed when the client disconnects, for ending the handler's event loop.
+func (this *EventStream) Done() <-chan struct{} {
+	return this.c.R.Context().Done()
+}
@@ -0,0 +1,92 @@
+package milk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSSE(t *testing.T) {
+	tests := []struct {
+		name        string
+		w           *httptest.ResponseRecorder
+		plain       bool // plain hides the Flusher of the recorder
+		status      int
+		body        string
+		contentType string
+	}{
+		{
+			name:        "flushable writer",
+			status:      200,
+			body:        "id: 1\nevent: greeting\ndata: {\"text\":\"hi\"}\n\n" + "data: [1,2]\n\n",
+			contentType: "text/event-stream",
+		},
+		{
+			name:        "writer without flushing",
+			plain:       true,
+			status:      500,
+			contentType: "application/json",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := newTestRouter()
+			r.Get("/events", func(c *Context) error {
+				stream, err := c.SSE()
+				if err != nil {
+					return err
+				}
+				if err := stream.Send("greeting", "1", map[string]string{"text": "hi"}); err != nil {
+					return err
+				}
+				return stream.Send("", "", []int{1, 2})
+			})
+			w := httptest.NewRecorder()
+			var rw http.ResponseWriter = w
+			if test.plain {
+				rw = &plainResponseWriter{w}
+			}
+			r.ServeHTTP(rw, httptest.NewRequest("GET", "/events", nil))
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if test.body != "" && w.Body.String() != test.body {
+				t.Errorf("expected body %q, got %q", test.body, w.Body)
+			}
+			if got := w.Header().Get("Content-Type"); got != test.contentType {
+				t.Errorf("expected content type %q, got %q", test.contentType, got)
+			}
+			if w.Flushed == test.plain {
+				t.Errorf("expected the events to be flushed: %v, got %v", !test.plain, w.Flushed)
+			}
+		})
+	}
+}
+
+func TestSSEDone(t *testing.T) {
+	r, _ := newTestRouter()
+	done := make(chan struct{})
+	r.Get("/events", func(c *Context) error {
+		stream, err := c.SSE()
+		if err != nil {
+			return err
+		}
+		defer close(done)
+		select {
+		case <-stream.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+			t.Error("expected Done to be closed when the client disconnects")
+			return nil
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+	<-done
+}
@@ -0,0 +1,91 @@
+package milk
+
+import (
+	"encoding/xml"
+	"fmt"
+	"runtime"
+)
+
+// Frame is a frame of a stack trace.
+type Frame struct {
+	Function string `json:"function" xml:"function"`
+	File     string `json:"file" xml:"file"`
+	Line     int    `json:"line" xml:"line"`
+}
+
+func (this Frame) String() string {
+	return fmt.Sprintf("%s\n\t%s:%d", this.Function, this.File, this.Line)
+}
+
+// Stack returns the stack trace of the calling goroutine, skipping skip frames.
+// Stack(0) starts with the frame of the caller of Stack.
+func Stack(skip int) []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []Frame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			return stack
+		}
+	}
+}
+
+// panicError is the error recorded on a context for a recovered panic.
+type panicError struct {
+	value interface{}
+	stack []Frame // stack holds the frames from the panic up to the handler that panicked
+}
+
+func (this *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", this.value)
+}
+
+// newPanicError returns the error of the panic v, to be called by the function recovering the panic.
+// The stack is trimmed to the frames from the panic up to the handler, leaving out the package's
+// own dispatching of handlers and the frames of the server below.
+func newPanicError(v interface{}) *panicError {
+	stack := Stack(1)
+	for i, frame := range stack {
+		if frame.Function == "runtime.gopanic" {
+			stack = stack[i+1:]
+			break
+		}
+	}
+	for i, frame := range stack {
+		if frame.Function == pkgPath+".(*Context).Next" {
+			stack = stack[:i]
+			break
+		}
+	}
+	return &panicError{value: v, stack: stack}
+}
+
+// panicResponse is the response to a panic in debug mode, see Router.Debug.
+type panicResponse struct {
+	XMLName    xml.Name `json:"-" xml:"error"`
+	StatusCode int      `json:"statusCode" xml:"statusCode"`
+	Message    string   `json:"message" xml:"message"`
+	Panic      string   `json:"panic" xml:"panic"`
+	Stack      []Frame  `json:"stack" xml:"stack>frame"`
+}
+
+// Debug enables or disables debug mode for the router and its sub-routers, unless they set it themselves.
+// In debug mode, a panic in a handler is answered with a 500 response including the panic value and the stack
+// trace of the panic. Otherwise the response carries no details, and the stack trace is only logged.
+// Debug mode must not be enabled in production.
+func (this *Router) Debug(enabled bool) {
+	this.debug = &enabled
+}
+
+func (this *Router) debugEnabled() bool {
+	if this.debug != nil {
+		return *this.debug
+	} else if this.parent != nil {
+		return this.parent.debugEnabled()
+	} else {
+		return false
+	}
+}
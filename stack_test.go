@@ -0,0 +1,117 @@
+package milk
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	r, logger := newTestRouter()
+	var handled interface{}
+	r.PanicHandler = func(c *Context, v interface{}) { handled = v }
+	r.Get("/panic", func(c *Context) error { panic("boom") })
+	r.Get("/ok", func(c *Context) error { c.Result = "ok"; return nil })
+
+	tests := []struct {
+		url    string
+		status int
+		body   string
+	}{
+		{url: "/panic", status: 500, body: `{"statusCode":500,"message":"Internal server error"}`},
+		{url: "/ok", status: 200, body: `"ok"`},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			w := serveRequest(r, "GET", test.url, nil)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d, got %d", test.status, w.Code)
+			}
+			if body := strings.TrimSpace(w.Body.String()); body != test.body {
+				t.Errorf("expected body %s, got %s", test.body, body)
+			}
+		})
+	}
+	if handled != "boom" {
+		t.Errorf("expected the panic handler to get the panic value, got %v", handled)
+	}
+	var logged bool
+	for _, entry := range logger.Entries() {
+		logged = logged || (entry.Level == "ERROR" && strings.Contains(entry.Message, "panic serving GET /panic: boom"))
+	}
+	if !logged {
+		t.Errorf("expected the panic to be logged, got %v", logger.Entries())
+	}
+}
+
+func panickingHandler(c *Context) error {
+	panic("handler failed")
+}
+
+func TestDebugPanicResponses(t *testing.T) {
+	tests := []struct {
+		name  string
+		debug bool
+		sub   *bool // debug setting of the sub-router, if any
+	}{
+		{name: "production"},
+		{name: "debug", debug: true},
+		{name: "debug disabled on sub-router", debug: true, sub: new(bool)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, logger := newTestRouter()
+			r.Debug(test.debug)
+			sub := r.SubRouter("/sub")
+			if test.sub != nil {
+				sub.Debug(*test.sub)
+			}
+			sub.Get("/panic", panickingHandler)
+			w := serveRequest(r, "GET", "/sub/panic", nil)
+			if w.Code != 500 {
+				t.Fatalf("expected status 500, got %d", w.Code)
+			}
+			var body struct {
+				StatusCode int     `json:"statusCode"`
+				Panic      string  `json:"panic"`
+				Stack      []Frame `json:"stack"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.StatusCode != 500 {
+				t.Fatalf("expected a JSON 500 body, got %s", w.Body.String())
+			}
+			debug := test.debug && test.sub == nil
+			if debug {
+				if body.Panic != "handler failed" {
+					t.Errorf("expected the panic value in the body, got %q", body.Panic)
+				}
+				if len(body.Stack) == 0 || !strings.HasSuffix(body.Stack[0].Function, ".panickingHandler") {
+					t.Errorf("expected the stack to start at the panicking handler, got %v", body.Stack)
+				}
+				for _, frame := range body.Stack {
+					if strings.HasSuffix(frame.Function, "(*Context).Next") || strings.HasPrefix(frame.Function, "net/http.") {
+						t.Errorf("expected the frames below the handler to be elided, got %v", frame)
+					}
+				}
+			} else if body.Panic != "" || body.Stack != nil || strings.Contains(w.Body.String(), "handler failed") {
+				t.Errorf("expected no panic details outside debug mode, got %s", w.Body.String())
+			}
+			var logged bool
+			for _, entry := range logger.Entries() {
+				logged = logged || strings.Contains(entry.Message, "panickingHandler")
+			}
+			if !logged {
+				t.Error("expected the stack to be logged")
+			}
+		})
+	}
+}
+
+func TestStack(t *testing.T) {
+	stack := Stack(0)
+	if len(stack) == 0 || !strings.HasSuffix(stack[0].Function, ".TestStack") || !strings.HasSuffix(stack[0].File, "stack_test.go") {
+		t.Fatalf("expected the stack to start with the caller, got %v", stack)
+	}
+	if skipped := Stack(1); skipped[0].Function != stack[1].Function {
+		t.Errorf("expected Stack(1) to skip the caller, got %v", skipped[0])
+	}
+}
@@ -1,15 +1,75 @@
 package milk
 
-type Values map[interface{}]interface{}
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
 
-// Get returns the given key's value from the request path parameters or querystring.
-// The request path is searched first, and overrides any querystring values with the same key.
-func (this Values) Get(key interface{}) interface{} {
-	return this[key]
+// Values holds context specific values. It is safe for concurrent use, e.g. by goroutines started by a handler
+// to fetch data in parallel. The zero value is an empty Values ready to use.
+type Values struct {
+	mu sync.RWMutex
+	m  map[interface{}]interface{}
 }
 
-func (this Values) GetString(key interface{}) string {
-	if val, ok := this[key]; ok {
+// Key is the type of the well-known keys the package stores in a context's Values.
+type Key string
+
+const (
+	// KeyOriginalMethod holds the original method of a request whose method was overridden (see Router.MethodOverride)
+	KeyOriginalMethod Key = "originalMethod"
+
+	// KeyAPIVersion holds the API version of requests to routes of a router created by Router.Version
+	KeyAPIVersion Key = "apiVersion"
+)
+
+// Get returns the given key's value, or nil if it isn't set.
+func (this *Values) Get(key interface{}) interface{} {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	return this.m[key]
+}
+
+// GetOK returns the given key's value and whether it's set.
+func (this *Values) GetOK(key interface{}) (interface{}, bool) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+	val, ok := this.m[key]
+	return val, ok
+}
+
+// MustGet is like Get, but panics if the key isn't set, e.g. when a middleware a handler depends on hasn't run.
+// Panics in handlers are recovered by the router, resulting in a 500 response.
+func (this *Values) MustGet(key interface{}) interface{} {
+	val, ok := this.GetOK(key)
+	if !ok {
+		panic(fmt.Sprintf("milk: value %v (%T) not set", key, key))
+	}
+	return val
+}
+
+// MustGetString is like GetString, but panics if the key isn't set or its value isn't a string.
+func (this *Values) MustGetString(key interface{}) string {
+	val, ok := this.MustGet(key).(string)
+	if !ok {
+		panic(fmt.Sprintf("milk: value %v (%T) has type %T, not string", key, key, this.Get(key)))
+	}
+	return val
+}
+
+// MustGetInt64 is like GetInt64, but panics if the key isn't set or its value isn't an integer fitting an int64.
+func (this *Values) MustGetInt64(key interface{}) int64 {
+	val, ok := toInt64(this.MustGet(key))
+	if !ok {
+		panic(fmt.Sprintf("milk: value %v (%T) has type %T, not int64", key, key, this.Get(key)))
+	}
+	return val
+}
+
+func (this *Values) GetString(key interface{}) string {
+	if val := this.Get(key); val != nil {
 		if str, ok := val.(string); ok {
 			return str
 		}
@@ -17,28 +77,111 @@ func (this Values) GetString(key interface{}) string {
 	return ""
 }
 
-// GetInt64 returns the given key's value as an int.
+// GetInt returns the given key's value as an int. Values of other integer types are converted if they fit.
 // Returns 0 for invalid or missing values.
-func (this Values) GetInt(key interface{}) int {
-	if val, ok := this[key]; ok {
-		if v, ok := val.(int); ok {
-			return v
-		}
+func (this *Values) GetInt(key interface{}) int {
+	if v, ok := toInt64(this.Get(key)); ok && int64(int(v)) == v {
+		return int(v)
 	}
 	return 0
 }
 
-// GetInt64 returns the given key's value as an int64.
+// GetInt64 returns the given key's value as an int64. Values of other integer types are converted if they fit.
 // Returns 0 for invalid or missing values.
-func (this Values) GetInt64(key interface{}) int64 {
-	if val, ok := this[key]; ok {
-		if v, ok := val.(int64); ok {
-			return v
+func (this *Values) GetInt64(key interface{}) int64 {
+	v, _ := toInt64(this.Get(key))
+	return v
+}
+
+// GetFloat64 returns the given key's value as a float64. Values of other numeric types are converted.
+// Returns 0 for invalid or missing values.
+func (this *Values) GetFloat64(key interface{}) float64 {
+	val := this.Get(key)
+	switch v := val.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	}
+	v, _ := toInt64(val)
+	return float64(v)
+}
+
+// GetBool returns the given key's value as a bool.
+// Returns false for invalid or missing values.
+func (this *Values) GetBool(key interface{}) bool {
+	v, _ := this.Get(key).(bool)
+	return v
+}
+
+// GetTime returns the given key's value as a time.Time.
+// Returns the zero value for invalid or missing values.
+func (this *Values) GetTime(key interface{}) time.Time {
+	v, _ := this.Get(key).(time.Time)
+	return v
+}
+
+// GetStringSlice returns the given key's value as a []string.
+// Returns nil for invalid or missing values.
+func (this *Values) GetStringSlice(key interface{}) []string {
+	v, _ := this.Get(key).([]string)
+	return v
+}
+
+// GetBytes returns the given key's value as a []byte.
+// Returns nil for invalid or missing values.
+func (this *Values) GetBytes(key interface{}) []byte {
+	v, _ := this.Get(key).([]byte)
+	return v
+}
+
+// toInt64 returns val as an int64 if it's of an integer type and fits.
+func toInt64(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		if uint64(v) <= math.MaxInt64 {
+			return int64(v), true
+		}
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
 		}
 	}
-	return 0
+	return 0, false
 }
 
-func (this Values) Set(key interface{}, val interface{}) {
-	this[key] = val
+func (this *Values) Set(key interface{}, val interface{}) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.m == nil {
+		this.m = make(map[interface{}]interface{})
+	}
+	this.m[key] = val
+}
+
+// reset removes all values, keeping the map for reuse.
+func (this *Values) reset() {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for key := range this.m {
+		delete(this.m, key)
+	}
 }
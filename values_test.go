@@ -0,0 +1,145 @@
+package milk
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValuesGetters(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		val  interface{}
+		get  func(v *Values) interface{}
+		want string
+	}{
+		{name: "string", val: "a", get: func(v *Values) interface{} { return v.GetString("k") }, want: "a"},
+		{name: "string of other type", val: 1, get: func(v *Values) interface{} { return v.GetString("k") }, want: ""},
+		{name: "int", val: 5, get: func(v *Values) interface{} { return v.GetInt("k") }, want: "5"},
+		{name: "int from int32", val: int32(5), get: func(v *Values) interface{} { return v.GetInt("k") }, want: "5"},
+		{name: "int from uint8", val: uint8(5), get: func(v *Values) interface{} { return v.GetInt64("k") }, want: "5"},
+		{name: "int64 overflowing", val: uint64(math.MaxUint64), get: func(v *Values) interface{} { return v.GetInt64("k") }, want: "0"},
+		{name: "int of other type", val: "5", get: func(v *Values) interface{} { return v.GetInt("k") }, want: "0"},
+		{name: "float64", val: 1.5, get: func(v *Values) interface{} { return v.GetFloat64("k") }, want: "1.5"},
+		{name: "float64 from float32", val: float32(0.5), get: func(v *Values) interface{} { return v.GetFloat64("k") }, want: "0.5"},
+		{name: "float64 from int", val: 3, get: func(v *Values) interface{} { return v.GetFloat64("k") }, want: "3"},
+		{name: "float64 from uint64", val: uint64(math.MaxUint64), get: func(v *Values) interface{} { return v.GetFloat64("k") }, want: "1.8446744073709552e+19"},
+		{name: "bool", val: true, get: func(v *Values) interface{} { return v.GetBool("k") }, want: "true"},
+		{name: "bool of other type", val: "true", get: func(v *Values) interface{} { return v.GetBool("k") }, want: "false"},
+		{name: "time", val: now, get: func(v *Values) interface{} { return v.GetTime("k").Format(time.RFC3339) }, want: "2021-06-01T00:00:00Z"},
+		{name: "time missing", get: func(v *Values) interface{} { return v.GetTime("k").IsZero() }, want: "true"},
+		{name: "string slice", val: []string{"a", "b"}, get: func(v *Values) interface{} { return v.GetStringSlice("k") }, want: "[a b]"},
+		{name: "bytes", val: []byte("ab"), get: func(v *Values) interface{} { return string(v.GetBytes("k")) }, want: "ab"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var v Values
+			if test.val != nil {
+				v.Set("k", test.val)
+			}
+			if got := fmt.Sprint(test.get(&v)); got != test.want {
+				t.Errorf("expected %s, got %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestValuesGetOK(t *testing.T) {
+	var v Values
+	v.Set("nil", nil)
+	v.Set("s", "a")
+	tests := []struct {
+		key  string
+		val  interface{}
+		want bool
+	}{
+		{key: "s", val: "a", want: true},
+		{key: "nil", want: true},
+		{key: "missing"},
+	}
+	for _, test := range tests {
+		if val, ok := v.GetOK(test.key); val != test.val || ok != test.want {
+			t.Errorf("GetOK(%q): expected %v %v, got %v %v", test.key, test.val, test.want, val, ok)
+		}
+	}
+}
+
+func TestValuesMustGet(t *testing.T) {
+	type userKey struct{}
+	tests := []struct {
+		name  string
+		get   func(v *Values) interface{}
+		want  string
+		panic string // panic is a substring of the expected panic message
+	}{
+		{name: "set", get: func(v *Values) interface{} { return v.MustGet("user") }, want: "ann"},
+		{name: "string", get: func(v *Values) interface{} { return v.MustGetString("user") }, want: "ann"},
+		{name: "int64", get: func(v *Values) interface{} { return v.MustGetInt64("count") }, want: "3"},
+		{name: "missing", get: func(v *Values) interface{} { return v.MustGet("account") }, panic: "value account (string) not set"},
+		{name: "missing typed key", get: func(v *Values) interface{} { return v.MustGet(userKey{}) }, panic: "(milk.userKey) not set"},
+		{name: "not a string", get: func(v *Values) interface{} { return v.MustGetString("count") }, panic: "value count (string) has type int, not string"},
+		{name: "not an integer", get: func(v *Values) interface{} { return v.MustGetInt64("user") }, panic: "value user (string) has type string, not int64"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var v Values
+			v.Set("user", "ann")
+			v.Set("count", 3)
+			var got interface{}
+			var recovered interface{}
+			func() {
+				defer func() { recovered = recover() }()
+				got = test.get(&v)
+			}()
+			if test.panic != "" {
+				if msg, _ := recovered.(string); !strings.Contains(msg, test.panic) {
+					t.Errorf("expected a panic containing %q, got %v", test.panic, recovered)
+				}
+			} else if recovered != nil || fmt.Sprint(got) != test.want {
+				t.Errorf("expected %s, got %v (panic %v)", test.want, got, recovered)
+			}
+		})
+	}
+
+	t.Run("in a handler", func(t *testing.T) {
+		r, _ := newTestRouter()
+		r.Get("/x", func(c *Context) error { c.Result = c.Values.MustGetString("user"); return nil })
+		if w := serveRequest(r, "GET", "/x", nil); w.Code != 500 {
+			t.Errorf("expected a missing value to result in a 500, got %d", w.Code)
+		}
+	})
+}
+
+func TestValuesConcurrency(t *testing.T) {
+	r, _ := newTestRouter()
+	r.Get("/x", func(c *Context) error {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					key := fmt.Sprint("k", i)
+					c.Values.Set(key, j)
+					c.Values.GetInt(key)
+					c.Values.GetOK("shared")
+					c.Values.Set("shared", i)
+				}
+			}(i)
+		}
+		wg.Wait()
+		sum := 0
+		for i := 0; i < 10; i++ {
+			sum += c.Values.GetInt(fmt.Sprint("k", i))
+		}
+		c.Result = sum
+		return nil
+	})
+	if w := serveRequest(r, "GET", "/x", nil); strings.TrimSpace(w.Body.String()) != "990" {
+		t.Errorf("expected every goroutine's last value to be kept, got %s", w.Body)
+	}
+}